@@ -1,6 +1,7 @@
 package app
 
 import (
+	"fmt"
 	"time"
 	"context"
 
@@ -15,6 +16,8 @@ import (
 	"github.com/amaretur/auth-service/internal/infrastructure/server"
 
 	http "github.com/amaretur/auth-service/internal/transport/http/handler"
+	"github.com/amaretur/auth-service/internal/transport/http/middleware"
+	"github.com/amaretur/auth-service/internal/entity"
 	"github.com/amaretur/auth-service/internal/usecase"
 	"github.com/amaretur/auth-service/internal/service"
 	"github.com/amaretur/auth-service/internal/repository"
@@ -67,7 +70,7 @@ func (a *App) Init() error {
 
 	err = client.
 		Database(a.config.MongoDB.Database).
-		RunCommand(ctx2, bson.D{{"ping", 1}}).
+		RunCommand(ctx2, bson.D{{Key: "ping", Value: 1}}).
 		Err()
 
 	if err != nil {
@@ -91,24 +94,380 @@ func (a *App) Init() error {
 		a.logger.Info("connection to mongodb successfully closed")
 	})
 
-	// Создание репозитория
+	// Создание репозиториев
+	repoLogger := a.logger.WithFields(map[string]any{"layer": "repository"})
+
 	repo := repository.NewTokenRepositoryMongo(
 		client.Database(a.config.MongoDB.Database),
-		a.logger.WithFields(map[string]any{"layer": "repository"}),
+		repoLogger,
+	)
+
+	notBeforeRepo := repository.NewNotBeforeRepositoryMongo(
+		client.Database(a.config.MongoDB.Database),
+		repoLogger,
+	)
+
+	codeRepo := repository.NewAuthorizationCodeRepositoryMongo(
+		client.Database(a.config.MongoDB.Database),
+		repoLogger,
+	)
+
+	ctx3, cancel3 := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel3()
+
+	if err := repo.CreateIndexes(ctx3); err != nil {
+		return err
+	}
+
+	if err := notBeforeRepo.CreateIndexes(ctx3); err != nil {
+		return err
+	}
+
+	if err := codeRepo.CreateIndexes(ctx3); err != nil {
+		return err
+	}
+
+	// Список отозванных access токенов
+	var denylistStore service.Denylist
+
+	switch a.config.Jwt.Denylist {
+		case "memory":
+			denylistStore = repository.NewDenylistMemory()
+
+		case "mongodb":
+			denylistMongo := repository.NewDenylistMongo(
+				client.Database(a.config.MongoDB.Database),
+				repoLogger,
+			)
+
+			if err := denylistMongo.CreateIndexes(ctx3); err != nil {
+				return err
+			}
+
+			denylistStore = denylistMongo
+
+		default:
+			err := fmt.Errorf("unknown denylist: %s", a.config.Jwt.Denylist)
+			a.logger.Error(err)
+
+			return err
+	}
+
+	// Использованные jti DPoP доказательств
+	var dpopReplay service.DPoPReplayCache
+
+	switch a.config.DPoP.ReplayCache {
+		case "memory":
+			dpopReplay = repository.NewDPoPReplayMemory()
+
+		case "mongodb":
+			dpopReplayMongo := repository.NewDPoPReplayMongo(
+				client.Database(a.config.MongoDB.Database),
+				repoLogger,
+			)
+
+			if err := dpopReplayMongo.CreateIndexes(ctx3); err != nil {
+				return err
+			}
+
+			dpopReplay = dpopReplayMongo
+
+		default:
+			err := fmt.Errorf("unknown dpop replay cache: %s", a.config.DPoP.ReplayCache)
+			a.logger.Error(err)
+
+			return err
+	}
+
+	// Непрозрачные access токены и их утверждения
+	switch a.config.Jwt.AccessTokenFormat {
+		case service.AccessTokenJwt, service.AccessTokenOpaque:
+		default:
+			err := fmt.Errorf(
+				"unknown access token format: %s", a.config.Jwt.AccessTokenFormat,
+			)
+			a.logger.Error(err)
+
+			return err
+	}
+
+	opaqueRepo := repository.NewOpaqueTokenMongo(
+		client.Database(a.config.MongoDB.Database),
+		repoLogger,
+	)
+
+	if err := opaqueRepo.CreateIndexes(ctx3); err != nil {
+		return err
+	}
+
+	denylist := repository.NewDenylistCache(
+		denylistStore,
+		a.config.Jwt.DenylistCacheTtl*time.Second,
+		a.config.Jwt.AccessExpire*time.Minute,
+	)
+
+	// Отзыв всех сессий кешируется на то же время, что и проверка отзыва
+	notBefore := repository.NewNotBeforeCache(
+		notBeforeRepo,
+		a.config.Jwt.DenylistCacheTtl*time.Second,
+	)
+
+	// Ограничения сессий пользователя
+	sessionPolicy := service.SessionPolicy{
+		MaxSessions: a.config.Jwt.MaxSessions,
+		Eviction: a.config.Jwt.SessionEviction,
+		MaxAge: a.config.Jwt.SessionMaxAge,
+		IdleTimeout: a.config.Jwt.IdleTimeout,
+	}
+
+	switch sessionPolicy.Eviction {
+		case service.EvictOldest, service.RejectNew:
+		default:
+			err := fmt.Errorf(
+				"unknown session eviction: %s", sessionPolicy.Eviction,
+			)
+			a.logger.Error(err)
+
+			return err
+	}
+
+	sessionLock := repository.NewSessionLockMongo(
+		client.Database(a.config.MongoDB.Database),
+		repoLogger,
 	)
 
+	// Роли, разрешения и области доступа пользователей
+	claimsProvider, err := repository.NewClaimsFile(a.config.Jwt.ClaimsFile)
+	if err != nil {
+		a.logger.Errorf("load user claims: %s", err)
+
+		return err
+	}
+
+	// Профили пользователей для /userinfo
+	profiles, err := repository.NewProfileFile(a.config.Oidc.ProfilesFile)
+	if err != nil {
+		a.logger.Errorf("load user profiles: %s", err)
+
+		return err
+	}
+
+	// Дополнительные утверждения access токена
+	var enricher service.ClaimsEnricher
+
+	if webhook := a.config.Jwt.ClaimsWebhook; webhook.Url != "" {
+
+		switch webhook.Fallback {
+			case repository.WebhookFallbackSkip, repository.WebhookFallbackFail:
+			default:
+				err := fmt.Errorf(
+					"unknown claims webhook fallback: %s", webhook.Fallback,
+				)
+				a.logger.Error(err)
+
+				return err
+		}
+
+		enricher = repository.NewClaimsWebhook(
+			webhook.Url,
+			webhook.Timeout * time.Millisecond,
+			webhook.Fallback,
+			repoLogger,
+		)
+	}
+
+	// Загрузка ключей подписи access токенов
+	key, retiredKeys, err := loadKeys(a.config.Jwt)
+	if err != nil {
+		a.logger.Errorf("load signing keys: %s", err)
+
+		return err
+	}
+
+	keyRing := service.NewKeyRing(key, retiredKeys...)
+
+	if key.Symmetric() {
+		a.logger.Warn("HS512 signing key: openid connect is disabled")
+	}
+
+	// Ротация ключей при изменении конфигурации, без перезапуска
+	config.Watch(func(conf *config.Config) {
+
+		key, retiredKeys, err := loadKeys(conf.Jwt)
+		if err != nil {
+			a.logger.Errorf("reload signing keys: %s", err)
+			return
+		}
+
+		keyRing.Rotate(key, retiredKeys...)
+
+		a.logger.Infof("signing keys reloaded, active key: %s", key.Id())
+
+	}, func(err error) {
+		a.logger.Errorf("reload config: %s", err)
+	})
+
 	// Создание сервисов
 	jwtService := service.NewJwt(
 		repo,
+		notBefore,
+		denylist,
+		opaqueRepo,
+		sessionLock,
+		claimsProvider,
+		enricher,
 		a.config.Jwt.AccessExpire,
 		a.config.Jwt.RefreshExpire,
-		a.config.Jwt.Secret,
+		a.config.Jwt.AccessTokenFormat,
+		sessionPolicy,
+		service.ClaimsPolicy{
+			Issuer: a.config.Jwt.Issuer,
+			Audience: a.config.Jwt.Audience,
+			Leeway: a.config.Jwt.Leeway,
+		},
+		keyRing,
+		a.logger.WithFields(map[string]any{"layer": "service"}),
+	)
+
+	if a.config.Jwt.Issuer == "" {
+		a.logger.Warn("jwt.issuer is not set: openid connect is disabled")
+	}
+
+	// Реестр клиентов
+	var clientRepo service.ClientRepository
+
+	switch a.config.ClientRegistry.Store {
+		case "file":
+			clients := make([]*entity.Client, 0, len(a.config.Clients))
+
+			for _, c := range a.config.Clients {
+
+				switch c.AccessTokenFormat {
+					case "", service.AccessTokenJwt, service.AccessTokenOpaque:
+					default:
+						err := fmt.Errorf(
+							"unknown access token format of client %s: %s",
+							c.Id, c.AccessTokenFormat,
+						)
+						a.logger.Error(err)
+
+						return err
+				}
+
+				clients = append(clients, &entity.Client{
+					Id: c.Id,
+					SecretHash: c.SecretHash,
+					GrantTypes: c.GrantTypes,
+					Scopes: c.Scopes,
+					Audience: c.Audience,
+					RedirectUris: c.RedirectUris,
+					Public: c.Public,
+					TlsSubjectDn: c.TlsSubjectDn,
+					TlsSanDns: c.TlsSanDns,
+					AccessExpire: c.AccessExpire,
+					RefreshExpire: c.RefreshExpire,
+					AccessTokenFormat: c.AccessTokenFormat,
+				})
+			}
+
+			clientRepo = repository.NewClientRepositoryMemory(clients)
+
+		case "mongodb":
+			clientRepo = repository.NewClientRepositoryMongo(
+				client.Database(a.config.MongoDB.Database),
+				repoLogger,
+			)
+
+		default:
+			err := fmt.Errorf(
+				"unknown client registry store: %s",
+				a.config.ClientRegistry.Store,
+			)
+			a.logger.Error(err)
+
+			return err
+	}
+
+	clientService := service.NewClients(
+		clientRepo,
+		a.logger.WithFields(map[string]any{"layer": "service"}),
+	)
+
+	codeService := service.NewAuthorizationCodes(
+		codeRepo,
+		a.config.OAuth.CodeExpire,
 		a.logger.WithFields(map[string]any{"layer": "service"}),
 	)
 
+	exchangeRules := make([]entity.ExchangeRule, 0, len(a.config.TokenExchange))
+
+	for _, r := range a.config.TokenExchange {
+		exchangeRules = append(exchangeRules, entity.ExchangeRule{
+			ClientId: r.Client,
+			Audiences: r.Audiences,
+			Scopes: r.Scopes,
+			Impersonation: r.Impersonation,
+		})
+	}
+
+	exchangeService := service.NewTokenExchange(
+		jwtService,
+		exchangeRules,
+		a.logger.WithFields(map[string]any{"layer": "service"}),
+	)
+
+	// htu DPoP доказательств сверяется с внешним адресом сервиса
+	dpopBaseUrl := a.config.DPoP.BaseUrl
+	if dpopBaseUrl == "" {
+		dpopBaseUrl = a.config.Jwt.Issuer
+	}
+
+	if dpopBaseUrl == "" {
+		a.logger.Warn("neither dpop.base_url nor jwt.issuer is set: dpop proofs are rejected")
+	}
+
+	dpopService := service.NewDPoP(
+		dpopReplay,
+		dpopBaseUrl,
+		a.config.DPoP.MaxAge,
+		a.config.Jwt.Leeway,
+		a.logger.WithFields(map[string]any{"layer": "service"}),
+	)
+
+	trustedProxies, err := middleware.ParseTrustedProxies(a.config.Http.TrustedProxies)
+	if err != nil {
+		a.logger.Error(err)
+
+		return err
+	}
+
+	// Заголовок с пользователем принимается только от доверенных прокси
+	if len(trustedProxies) == 0 {
+		a.logger.Warn("server.trusted_proxies is empty: oauth.user_header is ignored")
+	}
+
+	userInfoService := service.NewUserInfo(
+		jwtService,
+		profiles,
+		a.logger.WithFields(map[string]any{"layer": "service"}),
+	)
+
+	// Сертификаты клиентов проверяются только на TLS сервере с CA клиентов
+	tlsClientAuth := a.config.Http.Tls.CertFile != "" &&
+		a.config.Http.Tls.ClientCaFile != "" &&
+		a.config.Http.Tls.ClientAuth != server.ClientAuthNone
+
 	// Создание юзкейсов
 	authUsecase := usecase.New(
 		jwtService,
+		clientService,
+		codeService,
+		service.NewHeaderAuthenticator(a.config.OAuth.UserHeader, trustedProxies),
+		userInfoService,
+		exchangeService,
+		dpopService,
+		a.config.ClientRegistry.RequireAuth,
+		tlsClientAuth,
 		a.logger.WithFields(map[string]any{"layer": "usecase"}),
 	)
 
@@ -119,9 +478,13 @@ func (a *App) Init() error {
 	})
 
 	// Создание и регистрация обработчиков
-	handler := http.NewHandler("/api/v1")
+	handler := http.NewHandler("/api/v1", trustedProxies)
 
 	handler.Register(http.NewAuth(authUsecase, httpLogger), "")
+	handler.Register(http.NewKeys(authUsecase, httpLogger), "")
+	handler.Register(http.NewOAuth(authUsecase, a.config.OAuth.LoginUrl, httpLogger), "")
+	handler.Register(http.NewOidc(authUsecase, httpLogger), "")
+	handler.Register(http.NewSessions(authUsecase, httpLogger), "/sessions")
 
 	a.httpHandler = handler
 
@@ -134,6 +497,19 @@ func (a *App) Run() error {
 
 	errChan := make(chan error, 1)
 
+	var tlsConfig *server.TlsConfig
+
+	if a.config.Http.Tls.CertFile != "" {
+		tlsConfig = &server.TlsConfig{
+			CertFile:		a.config.Http.Tls.CertFile,
+			KeyFile:		a.config.Http.Tls.KeyFile,
+			MinVersion:		a.config.Http.Tls.MinVersion,
+			CipherSuites:	a.config.Http.Tls.CipherSuites,
+			ClientCaFile:	a.config.Http.Tls.ClientCaFile,
+			ClientAuth:		a.config.Http.Tls.ClientAuth,
+		}
+	}
+
 	// Запуск HTTP сервера
 	go a.httpServer.Run(errChan, &server.HttpConfig{
 		Port:			a.config.Http.Port,
@@ -141,6 +517,7 @@ func (a *App) Run() error {
 		ReadTimeout:	a.config.Http.ReadTimeout,
 		WriteTimeout:	a.config.Http.WriteTimeout,
 		Handler:		a.httpHandler.Router(),
+		Tls:			tlsConfig,
 	})
 
 	if err := <- errChan; err != nil {
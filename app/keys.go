@@ -0,0 +1,60 @@
+package app
+
+import (
+	"time"
+
+	"github.com/amaretur/auth-service/config"
+
+	"github.com/amaretur/auth-service/internal/service"
+)
+
+// Загружает активный и выведенные из использования ключи подписи
+func loadKeys(conf config.Jwt) (*service.Key, []service.RetiredKey, error) {
+
+	active, err := service.LoadKey(
+		conf.Id,
+		conf.Algorithm,
+		conf.Secret,
+		conf.PrivateKey,
+	)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	retired := make([]service.RetiredKey, 0, len(conf.Retired))
+
+	for _, r := range conf.Retired {
+
+		key, err := service.LoadKey(r.Id, r.Algorithm, r.Secret, r.PrivateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		retired = append(retired, service.RetiredKey{
+			Key: key,
+			RetireAt: r.RetireAt,
+		})
+	}
+
+	// Ключ из прежней секции [jwt.previous] не имел срока окончания
+	if prev := conf.Previous; prev.Algorithm != "" {
+
+		key, err := service.LoadKey(
+			prev.Id,
+			prev.Algorithm,
+			prev.Secret,
+			prev.PrivateKey,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		retired = append(retired, service.RetiredKey{
+			Key: key,
+			RetireAt: time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC),
+		})
+	}
+
+	return active, retired, nil
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/viper"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
 )
 
 // Настройки http сервера
@@ -15,13 +17,109 @@ type Http struct {
 	MaxHeaderBytes	int
 	ReadTimeout		time.Duration
 	WriteTimeout	time.Duration
+	Tls				Tls
+
+	// Прокси (IP адреса или подсети), которым разрешено передавать
+	// адрес клиента в X-Forwarded-For
+	TrustedProxies	[]string
+}
+
+// Настройки TLS http сервера
+type Tls struct {
+	CertFile		string	// пустой - сервер работает без TLS
+	KeyFile			string
+
+	// Минимальная версия TLS: 1.2 или 1.3
+	MinVersion		string
+
+	// Наборы шифров TLS 1.2 (пустой - наборы Go по умолчанию)
+	CipherSuites	[]string
+
+	// CA для проверки сертификатов клиентов (mTLS)
+	ClientCaFile	string
+
+	// Запрос сертификата клиента: none, optional или require
+	ClientAuth		string
+}
+
+// Ключ подписи jwt токена
+type JwtKey struct {
+	// Идентификатор ключа (kid). Если не указан - вычисляется из ключа
+	Id				string	`mapstructure:"id"`
+
+	// HS512, RS256, ES256 или EdDSA
+	Algorithm		string	`mapstructure:"algorithm"`
+
+	// Секрет для HS512
+	Secret			string	`mapstructure:"secret"`
+
+	// Путь к приватному ключу (PEM) для RS256/ES256/EdDSA
+	PrivateKey		string	`mapstructure:"private_key"`
+}
+
+// Выведенный из использования ключ подписи
+type RetiredJwtKey struct {
+	JwtKey		`mapstructure:",squash"`
+
+	// Момент, после которого подписанные ключом токены не принимаются
+	RetireAt	time.Time	`mapstructure:"retire_at"`
 }
 
 // Конфигурация jwt токена
 type Jwt struct {
 	AccessExpire	time.Duration
 	RefreshExpire	time.Duration
-	Secret			string
+
+	// Формат access токенов: jwt или opaque (хранятся в БД)
+	AccessTokenFormat	string
+
+	// Активный ключ подписи
+	JwtKey
+
+	// Выведенные из использования ключи, токены которых еще принимаются
+	Retired			[]RetiredJwtKey
+
+	// Предыдущий ключ подписи (устарело, следует использовать Retired):
+	// принимается как выведенный ключ без срока окончания
+	Previous		JwtKey
+
+	// Хранилище отозванных access токенов: mongodb или memory
+	Denylist			string
+
+	// Время кеширования проверки отзыва access токена
+	DenylistCacheTtl	time.Duration
+
+	// Лимит одновременных сессий пользователя (0 - без ограничений)
+	MaxSessions			int
+
+	// Действие при достижении лимита: revoke_oldest или reject
+	SessionEviction		string
+
+	// Абсолютный срок сессии с момента входа (0 - без ограничения)
+	SessionMaxAge		time.Duration
+
+	// Допустимое время бездействия сессии (0 - без ограничения)
+	IdleTimeout			time.Duration
+
+	// Издатель (iss) и аудитории (aud) access токенов
+	Issuer				string
+	Audience			[]string
+
+	// Допустимое расхождение часов при проверке токенов
+	Leeway				time.Duration
+
+	// Файл с ролями, разрешениями и областями доступа пользователей
+	ClaimsFile			string
+
+	// Вебхук дополнительных утверждений access токена
+	ClaimsWebhook		ClaimsWebhook
+}
+
+// Конфигурация вебхука дополнительных утверждений
+type ClaimsWebhook struct {
+	Url			string			// пустой - вебхук не используется
+	Timeout		time.Duration
+	Fallback	string			// при ошибке вебхука: skip или fail
 }
 
 // Конфигурация mongodb
@@ -52,10 +150,74 @@ func (m MongoDB) ConnectURL() string {
 	return url
 }
 
+// Зарегистрированный клиент сервиса
+type Client struct {
+	Id			string		`mapstructure:"id"`
+	SecretHash	string		`mapstructure:"secret_hash"` // bcrypt хеш секрета
+	GrantTypes	[]string	`mapstructure:"grant_types"`
+	Scopes		[]string	`mapstructure:"scopes"`
+	Audience	[]string	`mapstructure:"audience"`
+
+	RedirectUris	[]string	`mapstructure:"redirect_uris"`
+	Public			bool		`mapstructure:"public"` // клиент без секрета
+
+	// Аутентификация по сертификату mTLS (RFC 8705)
+	TlsSubjectDn	string	`mapstructure:"tls_client_auth_subject_dn"`
+	TlsSanDns		string	`mapstructure:"tls_client_auth_san_dns"`
+
+	// Сроки жизни токенов клиента (0 - значения из секции jwt)
+	AccessExpire	time.Duration	`mapstructure:"access_expire"`
+	RefreshExpire	time.Duration	`mapstructure:"refresh_expire"`
+
+	// Формат access токенов клиента (пустой - из секции jwt)
+	AccessTokenFormat	string	`mapstructure:"access_token_format"`
+}
+
+// Правило обмена токенов (RFC 8693)
+type ExchangeRule struct {
+	Client			string		`mapstructure:"client"`
+	Audiences		[]string	`mapstructure:"audiences"`
+	Scopes			[]string	`mapstructure:"scopes"` // пустой - без ограничения
+	Impersonation	bool		`mapstructure:"impersonation"` // обмен без actor токена
+}
+
+// Конфигурация потока authorization code
+type OAuth struct {
+	CodeExpire	time.Duration	// срок жизни кода авторизации
+	LoginUrl	string			// страница входа пользователя
+	UserHeader	string			// заголовок с uuid пользователя, выполнившего вход
+}
+
+// Конфигурация OpenID Connect
+type Oidc struct {
+	ProfilesFile	string	// файл с профилями пользователей для /userinfo
+}
+
+// Конфигурация DPoP (RFC 9449)
+type DPoP struct {
+	ReplayCache	string			// хранилище использованных jti: mongodb или memory
+	MaxAge		time.Duration	// срок действия доказательства с момента iat
+
+	// Внешний адрес сервиса, от которого строится htu (пустой - jwt.issuer)
+	BaseUrl		string
+}
+
+// Конфигурация реестра клиентов
+type ClientRegistry struct {
+	Store		string	// file (секция clients) или mongodb
+	RequireAuth	bool	// вход и обновление только для клиентов
+}
+
 type Config struct {
-	Http	Http
-	Jwt		Jwt
-	MongoDB	MongoDB
+	Http			Http
+	Jwt				Jwt
+	MongoDB			MongoDB
+	ClientRegistry	ClientRegistry
+	Clients			[]Client
+	OAuth			OAuth
+	Oidc			Oidc
+	TokenExchange	[]ExchangeRule
+	DPoP			DPoP
 }
 
 func Init(path string) (*Config, error) {
@@ -68,22 +230,96 @@ func Init(path string) (*Config, error) {
 	viper.SetConfigType(ext)
 	viper.AddConfigPath(dir)
 
+	viper.SetDefault("jwt.algorithm", "HS512")
+	viper.SetDefault("jwt.access_token_format", "jwt")
+	viper.SetDefault("server.tls.min_version", "1.2")
+	viper.SetDefault("server.tls.client_auth", "optional")
+	viper.SetDefault("jwt.denylist", "mongodb")
+	viper.SetDefault("jwt.denylist_cache_ttl", 5)
+	viper.SetDefault("jwt.session_eviction", "revoke_oldest")
+	viper.SetDefault("client_registry.store", "file")
+	viper.SetDefault("oauth.code_expire", 60)
+	viper.SetDefault("oauth.user_header", "X-Authenticated-User")
+	viper.SetDefault("jwt.claims_webhook.timeout", 500)
+	viper.SetDefault("jwt.claims_webhook.fallback", "fail")
+	viper.SetDefault("dpop.replay_cache", "mongodb")
+	viper.SetDefault("dpop.max_age", 60)
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, err
 	}
 
+	return parse()
+}
+
+// Отслеживает изменения конфигурационного файла и вызывает onChange
+// с новой конфигурацией. Ошибки разбора передаются в onError
+func Watch(onChange func(*Config), onError func(error)) {
+
+	viper.OnConfigChange(func(e fsnotify.Event) {
+
+		c, err := parse()
+		if err != nil {
+			onError(err)
+			return
+		}
+
+		onChange(c)
+	})
+
+	viper.WatchConfig()
+}
+
+func parse() (*Config, error) {
+
 	c := &Config{
 		Http: Http{
 			Port: viper.GetInt("server.port"),
 			MaxHeaderBytes: viper.GetInt("server.max_header_bytes"),
 			ReadTimeout: viper.GetDuration("server.read_timeout"),
 			WriteTimeout: viper.GetDuration("server.write_timeout"),
+			TrustedProxies: viper.GetStringSlice("server.trusted_proxies"),
+			Tls: Tls{
+				CertFile: viper.GetString("server.tls.cert_file"),
+				KeyFile: viper.GetString("server.tls.key_file"),
+				MinVersion: viper.GetString("server.tls.min_version"),
+				CipherSuites: viper.GetStringSlice("server.tls.cipher_suites"),
+				ClientCaFile: viper.GetString("server.tls.client_ca_file"),
+				ClientAuth: viper.GetString("server.tls.client_auth"),
+			},
 		},
 
 		Jwt: Jwt{
 			AccessExpire: viper.GetDuration("jwt.access_expire"),
 			RefreshExpire: viper.GetDuration("jwt.refresh_expire"),
-			Secret: viper.GetString("jwt.secret"),
+			AccessTokenFormat: viper.GetString("jwt.access_token_format"),
+			JwtKey: JwtKey{
+				Id: viper.GetString("jwt.key_id"),
+				Algorithm: viper.GetString("jwt.algorithm"),
+				Secret: viper.GetString("jwt.secret"),
+				PrivateKey: viper.GetString("jwt.private_key"),
+			},
+			Previous: JwtKey{
+				Id: viper.GetString("jwt.previous.id"),
+				Algorithm: viper.GetString("jwt.previous.algorithm"),
+				Secret: viper.GetString("jwt.previous.secret"),
+				PrivateKey: viper.GetString("jwt.previous.private_key"),
+			},
+			Denylist: viper.GetString("jwt.denylist"),
+			DenylistCacheTtl: viper.GetDuration("jwt.denylist_cache_ttl"),
+			MaxSessions: viper.GetInt("jwt.max_sessions"),
+			SessionEviction: viper.GetString("jwt.session_eviction"),
+			SessionMaxAge: viper.GetDuration("jwt.session_max_age"),
+			IdleTimeout: viper.GetDuration("jwt.idle_timeout"),
+			Issuer: viper.GetString("jwt.issuer"),
+			Audience: viper.GetStringSlice("jwt.audience"),
+			Leeway: viper.GetDuration("jwt.leeway"),
+			ClaimsFile: viper.GetString("jwt.claims_file"),
+			ClaimsWebhook: ClaimsWebhook{
+				Url: viper.GetString("jwt.claims_webhook.url"),
+				Timeout: viper.GetDuration("jwt.claims_webhook.timeout"),
+				Fallback: viper.GetString("jwt.claims_webhook.fallback"),
+			},
 		},
 
 		MongoDB: MongoDB{
@@ -95,6 +331,45 @@ func Init(path string) (*Config, error) {
 			OpenTimeout: viper.GetDuration("mongodb.open_timeout"),
 			Database: viper.GetString("mongodb.database"),
 		},
+
+		ClientRegistry: ClientRegistry{
+			Store: viper.GetString("client_registry.store"),
+			RequireAuth: viper.GetBool("client_registry.require_auth"),
+		},
+
+		OAuth: OAuth{
+			CodeExpire: viper.GetDuration("oauth.code_expire"),
+			LoginUrl: viper.GetString("oauth.login_url"),
+			UserHeader: viper.GetString("oauth.user_header"),
+		},
+
+		Oidc: Oidc{
+			ProfilesFile: viper.GetString("oidc.profiles_file"),
+		},
+
+		DPoP: DPoP{
+			ReplayCache: viper.GetString("dpop.replay_cache"),
+			MaxAge: viper.GetDuration("dpop.max_age"),
+			BaseUrl: viper.GetString("dpop.base_url"),
+		},
+	}
+
+	err := viper.UnmarshalKey(
+		"jwt.retired",
+		&c.Jwt.Retired,
+		viper.DecodeHook(mapstructure.StringToTimeHookFunc(time.RFC3339)),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("parse jwt.retired: %s", err)
+	}
+
+	if err := viper.UnmarshalKey("clients", &c.Clients); err != nil {
+		return nil, fmt.Errorf("parse clients: %s", err)
+	}
+
+	if err := viper.UnmarshalKey("token_exchange", &c.TokenExchange); err != nil {
+		return nil, fmt.Errorf("parse token_exchange: %s", err)
 	}
 
 	return c, nil
@@ -0,0 +1,26 @@
+package dto
+
+// DPoP доказательство из заголовка запроса (RFC 9449)
+type DPoPProof struct {
+	Proof	string // JWT из заголовка DPoP
+	Method	string // HTTP метод запроса
+	Path	string // путь запроса: схема и хост - из внешнего адреса сервиса
+
+	// Access токен, предъявленный вместе с доказательством: его хеш
+	// сверяется с утверждением ath (пустой - при входе и обновлении)
+	AccessToken	string
+}
+
+// Access токен и подтверждения владения ключом, к которому он
+// может быть привязан, предъявленные вместе с ним
+type PresentedToken struct {
+	Token		string
+	Proof		*DPoPProof			// nil - без заголовка DPoP
+	Certificate	*ClientCertificate	// nil - сертификат mTLS не предъявлен
+}
+
+// Подтверждение владения ключом (RFC 7800)
+type Confirmation struct {
+	Jkt		string	`json:"jkt,omitempty"` // отпечаток DPoP ключа (RFC 9449)
+	X5tS256	string	`json:"x5t#S256,omitempty"` // отпечаток сертификата (RFC 8705)
+}
@@ -1,6 +1,145 @@
 package dto
 
+import (
+	"encoding/json"
+)
+
 type Tokens struct {
 	Access	string	`json:"access"`
 	Refresh	string	`json:"refresh"`
+
+	// Срок жизни access токена (сек.)
+	ExpiresIn	int64	`json:"expires_in,omitempty"`
+
+	// Области доступа через пробел: в ответе - выданные,
+	// в запросе на обновление - необязательное сужение
+	Scope	string	`json:"scope,omitempty"`
+
+	// DPoP для пары, привязанной к ключу клиента (RFC 9449)
+	TokenType	string	`json:"token_type,omitempty"`
+}
+
+// Запрос к конечной точке /token (RFC 6749)
+type TokenRequest struct {
+	GrantType	string
+	Scope		string
+
+	// authorization_code
+	Code			string
+	RedirectUri		string
+	CodeVerifier	string
+
+	// token exchange (RFC 8693)
+	SubjectToken		string
+	SubjectTokenType	string
+	ActorToken			string
+	ActorTokenType		string
+	Audience			string
+
+	Meta		*SessionMeta
+}
+
+// Запрос к конечной точке /authorize (RFC 6749, 4.1.1; RFC 7636, 4.3)
+type AuthorizeRequest struct {
+	ResponseType		string
+	ClientId			string
+	RedirectUri			string
+	Scope				string
+	State				string
+	CodeChallenge		string
+	CodeChallengeMethod	string
+	Nonce				string
+}
+
+// Результат авторизации: код (или ошибка), передаваемый клиенту
+// через redirect_uri вместе с state
+type AuthorizeResult struct {
+	RedirectUri	string
+	State		string
+	Code		string
+}
+
+// Сведения запроса, по которым определяется пользователь
+type UserAuthRequest struct {
+	Headers		map[string][]string
+	RemoteAddr	string // адрес соединения, без учета X-Forwarded-For
+}
+
+// Успешный ответ конечной точки /token (RFC 6749, 5.1)
+type TokenResponse struct {
+	AccessToken		string	`json:"access_token"`
+	IssuedTokenType	string	`json:"issued_token_type,omitempty"` // RFC 8693
+	TokenType		string	`json:"token_type"`
+	ExpiresIn		int64	`json:"expires_in"`
+	RefreshToken	string	`json:"refresh_token,omitempty"`
+	Scope			string	`json:"scope,omitempty"`
+	IdToken			string	`json:"id_token,omitempty"`
+}
+
+// Учетные данные клиента
+type ClientCredentials struct {
+	Id		string
+	Secret	string
+
+	// Проверенный сертификат mTLS (nil - соединение без сертификата)
+	Certificate	*ClientCertificate
+}
+
+// Сведения о сертификате клиента, предъявленном при mTLS
+type ClientCertificate struct {
+	SubjectDn	string
+	DnsNames	[]string
+
+	// SHA-256 сертификата в DER (x5t#S256, RFC 8705, 3.1)
+	Thumbprint	string
+}
+
+// Ответ на интроспекцию токена (RFC 7662)
+type Introspection struct {
+	Active		bool	`json:"active"`
+	Sub			string	`json:"sub,omitempty"`
+	Exp			int64	`json:"exp,omitempty"`
+	Iat			int64	`json:"iat,omitempty"`
+	Nbf			int64	`json:"nbf,omitempty"`
+	Iss			string	`json:"iss,omitempty"`
+	Aud			[]string	`json:"aud,omitempty"`
+	Jti			string	`json:"jti,omitempty"`
+	TokenType	string	`json:"token_type,omitempty"`
+	Scope		string	`json:"scope,omitempty"`
+	ClientId	string	`json:"client_id,omitempty"`
+	Cnf			*Confirmation	`json:"cnf,omitempty"`
+
+	// Полномочия пользователя из access токена: для непрозрачных
+	// токенов интроспекция - единственный способ их получить
+	Roles		[]string	`json:"roles,omitempty"`
+	Permissions	[]string	`json:"permissions,omitempty"`
+
+	// Дополнительные утверждения access токена (ClaimsEnricher)
+	Extra		map[string]any	`json:"-"`
+}
+
+// Добавляет к ответу дополнительные утверждения токена,
+// не переопределяя стандартные
+func (i *Introspection) MarshalJSON() ([]byte, error) {
+
+	type introspection Introspection
+
+	data, err := json.Marshal((*introspection)(i))
+	if err != nil || len(i.Extra) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]any)
+
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+
+	for name, value := range i.Extra {
+		if _, ok := merged[name]; !ok {
+			merged[name] = value
+		}
+	}
+
+	return json.Marshal(merged)
 }
@@ -0,0 +1,23 @@
+package dto
+
+// JSON Web Key (RFC 7517)
+type Jwk struct {
+	Kty	string	`json:"kty"`
+	Kid	string	`json:"kid,omitempty"`
+	Alg	string	`json:"alg,omitempty"`
+	Use	string	`json:"use,omitempty"`
+
+	// RSA
+	N	string	`json:"n,omitempty"`
+	E	string	`json:"e,omitempty"`
+
+	// EC и OKP (Ed25519)
+	Crv	string	`json:"crv,omitempty"`
+	X	string	`json:"x,omitempty"`
+	Y	string	`json:"y,omitempty"`
+}
+
+// JSON Web Key Set
+type Jwks struct {
+	Keys	[]Jwk	`json:"keys"`
+}
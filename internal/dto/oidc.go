@@ -0,0 +1,23 @@
+package dto
+
+// Метаданные OpenID провайдера (OpenID Connect Discovery 1.0)
+type OpenIdConfiguration struct {
+	Issuer								string		`json:"issuer"`
+	AuthorizationEndpoint				string		`json:"authorization_endpoint"`
+	TokenEndpoint						string		`json:"token_endpoint"`
+	UserinfoEndpoint					string		`json:"userinfo_endpoint"`
+	JwksUri								string		`json:"jwks_uri"`
+	RevocationEndpoint					string		`json:"revocation_endpoint"`
+	IntrospectionEndpoint				string		`json:"introspection_endpoint"`
+	ResponseTypesSupported				[]string	`json:"response_types_supported"`
+	GrantTypesSupported					[]string	`json:"grant_types_supported"`
+	SubjectTypesSupported				[]string	`json:"subject_types_supported"`
+	IdTokenSigningAlgValuesSupported	[]string	`json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported	[]string	`json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported		[]string	`json:"code_challenge_methods_supported"`
+	ScopesSupported						[]string	`json:"scopes_supported"`
+	ClaimsSupported						[]string	`json:"claims_supported"`
+
+	// RFC 8705, 3.3
+	TlsClientCertificateBoundAccessTokens	bool	`json:"tls_client_certificate_bound_access_tokens,omitempty"`
+}
@@ -0,0 +1,27 @@
+package dto
+
+import (
+	"time"
+)
+
+// Сведения о клиенте, открывающем сессию
+type SessionMeta struct {
+	UserAgent	string
+	ClientIp	string
+	DeviceName	string
+}
+
+// Активная сессия пользователя
+type Session struct {
+	Id				string		`json:"id"`
+	UserAgent		string		`json:"user_agent,omitempty"`
+	ClientIp		string		`json:"client_ip,omitempty"`
+	DeviceName		string		`json:"device_name,omitempty"`
+	CreatedAt		time.Time	`json:"created_at"`
+	LastRefreshedAt	time.Time	`json:"last_refreshed_at"`
+	ExpireAt		time.Time	`json:"expire_at"`
+	Scopes			[]string	`json:"scopes,omitempty"`
+
+	// Сессия, которой принадлежит access токен запроса
+	Current			bool		`json:"current"`
+}
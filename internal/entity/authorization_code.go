@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"time"
+)
+
+// Единственный поддерживаемый метод PKCE (RFC 7636)
+const CodeChallengeS256 = "S256"
+
+// Код авторизации (RFC 6749, 4.1), выданный клиенту после входа
+// пользователя. Код одноразовый и хранится в БД только в виде хеша
+type AuthorizationCode struct {
+	Hash			string // SHA-256 кода
+	ClientId		string
+	RedirectUri		string
+
+	// redirect_uri указан в запросе авторизации: тогда при обмене
+	// требуется то же значение (RFC 6749, 4.1.3)
+	RedirectUriExplicit	bool
+
+	Uuid			string // пользователь, подтвердивший вход
+	Scope			string // запрошенные области доступа
+
+	// PKCE (RFC 7636): BASE64URL(SHA256(code_verifier))
+	CodeChallenge	string
+
+	// OpenID Connect: nonce из запроса и момент входа пользователя
+	Nonce			string
+	AuthTime		time.Time
+
+	ExpireAt		time.Time
+}
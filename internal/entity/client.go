@@ -0,0 +1,86 @@
+package entity
+
+import (
+	"time"
+)
+
+// Способы получения токенов (grant types), которые может использовать клиент
+const (
+	GrantSignIn			= "sign_in"
+	GrantRefreshToken	= "refresh_token"
+	GrantClientCredentials	= "client_credentials"
+	GrantAuthorizationCode	= "authorization_code"
+	GrantTokenExchange		= "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+// Зарегистрированный клиент сервиса
+type Client struct {
+	Id			string
+	SecretHash	string // bcrypt хеш секрета клиента
+
+	GrantTypes	[]string // разрешенные способы получения токенов
+	Scopes		[]string // области доступа, которые может запросить клиент
+	Audience	[]string // аудитории access токенов клиента
+
+	// Адреса, на которые возвращается код авторизации
+	RedirectUris	[]string
+
+	// Публичный клиент (браузерное или мобильное приложение) не хранит
+	// секрет и получает токены по коду авторизации только с PKCE
+	Public			bool
+
+	// Аутентификация по сертификату mTLS (tls_client_auth, RFC 8705, 2.1):
+	// ожидаемый subject DN или DNS имя из SAN сертификата клиента
+	TlsSubjectDn	string
+	TlsSanDns		string
+
+	// Сроки жизни токенов клиента (мин.), 0 - значения по умолчанию
+	AccessExpire	time.Duration
+	RefreshExpire	time.Duration
+
+	// Формат access токенов: jwt или opaque (пустой - из конфигурации)
+	AccessTokenFormat	string
+}
+
+// Проверяет, зарегистрирован ли у клиента адрес возврата
+func (c *Client) AllowsRedirectUri(uri string) bool {
+
+	for _, u := range c.RedirectUris {
+		if u == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Проверяет, соответствует ли сертификат клиента зарегистрированному.
+// Клиент без subject DN и SAN не аутентифицируется по сертификату
+func (c *Client) AllowsCertificate(subjectDn string, dnsNames []string) bool {
+
+	if c.TlsSubjectDn != "" {
+		return subjectDn == c.TlsSubjectDn
+	}
+
+	if c.TlsSanDns != "" {
+		for _, name := range dnsNames {
+			if name == c.TlsSanDns {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Проверяет, разрешен ли клиенту способ получения токенов
+func (c *Client) AllowsGrant(grant string) bool {
+
+	for _, g := range c.GrantTypes {
+		if g == grant {
+			return true
+		}
+	}
+
+	return false
+}
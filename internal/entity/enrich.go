@@ -0,0 +1,8 @@
+package entity
+
+// Сведения, по которым подбираются дополнительные утверждения токена
+type EnrichRequest struct {
+	Uuid		string
+	ClientId	string // пустой, если клиент не известен
+	Scopes		[]string
+}
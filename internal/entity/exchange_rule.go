@@ -0,0 +1,16 @@
+package entity
+
+// Правило обмена токенов (RFC 8693): для каких аудиторий клиент
+// может получить токен от имени пользователя
+type ExchangeRule struct {
+	ClientId	string
+	Audiences	[]string
+
+	// Области доступа, которые можно сохранить при обмене
+	// (пустой - любые области subject токена)
+	Scopes		[]string
+
+	// Разрешен обмен без actor токена: клиент действует
+	// от имени пользователя, не указывая себя в утверждении act
+	Impersonation	bool
+}
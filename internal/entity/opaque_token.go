@@ -0,0 +1,15 @@
+package entity
+
+import (
+	"time"
+)
+
+// Непрозрачный access токен, хранящийся в БД вместе с утверждениями
+type OpaqueToken struct {
+	Lookup		string // SHA-256 токена
+	Claims		[]byte // утверждения токена (JSON)
+
+	// Момент удаления записи. Запись токена с refresh токеном хранится
+	// до истечения refresh токена: по ней находится пара при обновлении
+	ExpireAt	time.Time
+}
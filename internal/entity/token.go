@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"time"
+)
+
+// Refresh токен, хранящийся в БД
+type RefreshToken struct {
+	Id			string
+	Token		string // хеш токена
+
+	// SHA-256 токена для поиска токена без id (интроспекция, отзыв)
+	Lookup		string
+
+	ExpireAt	time.Time
+	Uuid		string // идентификатор пользователя
+
+	// Идентификатор семейства: все refresh токены, полученные
+	// последовательными обновлениями после одного входа
+	FamilyId	string
+
+	// Токен уже был обменян на новую пару. Повторное предъявление такого
+	// токена означает его утечку
+	Rotated		bool
+
+	// Сведения о сессии (переносятся в следующий токен семейства)
+	UserAgent		string
+	ClientIp		string
+	DeviceName		string
+	CreatedAt		time.Time // момент входа
+	LastRefreshedAt	time.Time // момент последнего обновления пары
+
+	// Абсолютный срок сессии: после него пару нельзя обновить,
+	// сколько бы раз она ни обновлялась (нулевой - без ограничения)
+	SessionExpireAt	time.Time
+
+	// Клиент, которому выдана сессия (пустой - без клиента)
+	ClientId		string
+
+	// Области доступа сессии: при обновлении могут только сужаться
+	// (nil - сессия создана до появления областей доступа)
+	Scopes			[]string
+
+	// Отпечаток DPoP ключа (RFC 9449): обновить пару может только
+	// владелец ключа (пустой - сессия не привязана к ключу)
+	Jkt				string
+
+	// Отпечаток сертификата mTLS (RFC 8705): обновить пару можно только
+	// с тем же сертификатом (пустой - сессия не привязана к сертификату)
+	X5t				string
+}
@@ -0,0 +1,10 @@
+package entity
+
+// Полномочия пользователя, включаемые в access токен
+type UserClaims struct {
+	Roles		[]string
+	Permissions	[]string
+
+	// Области доступа, которые пользователь может запросить
+	Scopes		[]string
+}
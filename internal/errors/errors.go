@@ -11,4 +11,37 @@ var (
 
 	InvalidToken = errutil.NewType("parse token error")
 	NotFound = errutil.NewType("not found")
+
+	// Достигнут лимит одновременных сессий пользователя
+	SessionLimit = errutil.NewType("session limit reached")
+
+	// Истек абсолютный срок сессии или время ее бездействия
+	SessionExpired = errutil.NewType("session expired")
+
+	// Запрошены области доступа, недоступные пользователю или сессии
+	InvalidScope = errutil.NewType("invalid scope")
+
+	// Клиент не прошел аутентификацию
+	Unauthorized = errutil.NewType("client authentication failed")
+
+	// Клиенту не разрешен запрошенный способ получения токенов
+	UnauthorizedClient = errutil.NewType("unauthorized client")
+
+	// Способ получения токенов не поддерживается
+	UnsupportedGrant = errutil.NewType("unsupported grant type")
+
+	// Запрос не содержит обязательных параметров или содержит неверные
+	InvalidRequest = errutil.NewType("invalid request")
+
+	// Код авторизации недействителен, истек или выдан другому клиенту
+	InvalidGrant = errutil.NewType("invalid grant")
+
+	// Клиенту не разрешено получать токены для запрошенной аудитории
+	InvalidTarget = errutil.NewType("invalid target")
+
+	// DPoP доказательство недействительно или не соответствует ключу сессии
+	InvalidDPoPProof = errutil.NewType("invalid dpop proof")
+
+	// Пользователь не выполнил вход
+	LoginRequired = errutil.NewType("login required")
 )
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"os"
+	"fmt"
+	"sync"
+	"strings"
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Сертификат сервера и CA сертификатов клиентов, которые перечитываются
+// с диска при изменении файлов. При ошибке чтения продолжают
+// использоваться прежние сертификаты
+type certReloader struct {
+	certFile	string
+	keyFile		string
+	caFile		string // пустой - без mTLS
+
+	mu			sync.RWMutex
+	cert		*tls.Certificate
+	clientCAs	*x509.CertPool
+
+	watcher		*fsnotify.Watcher
+	logger		log.Logger
+}
+
+func newCertReloader(
+	certFile string,
+	keyFile string,
+	caFile string,
+	logger log.Logger,
+) (*certReloader, error) {
+
+	r := &certReloader{
+		certFile: certFile,
+		keyFile: keyFile,
+		caFile: caFile,
+		logger: logger,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Для tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(
+	*tls.ClientHelloInfo,
+) (*tls.Certificate, error) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Текущий пул CA для проверки сертификатов клиентов
+func (r *certReloader) ClientCAs() *x509.CertPool {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.clientCAs
+}
+
+func (r *certReloader) load() error {
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load server certificate: %s", err)
+	}
+
+	var clientCAs *x509.CertPool
+
+	if r.caFile != "" {
+
+		clientCAs, err = loadCertPool(r.caFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+
+	return nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca: %s", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in client ca: %s", file)
+	}
+
+	return pool, nil
+}
+
+// Отслеживает каталоги файлов, а не сами файлы: при ротации файлы
+// обычно заменяются переименованием (в том числе symlink в kubernetes),
+// и наблюдение за прежним файлом после этого теряется
+func (r *certReloader) Watch() error {
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create watcher: %s", err)
+	}
+
+	dirs := map[string]bool{
+		filepath.Dir(r.certFile): true,
+		filepath.Dir(r.keyFile): true,
+	}
+
+	if r.caFile != "" {
+		dirs[filepath.Dir(r.caFile)] = true
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+
+			return fmt.Errorf("watch %s: %s", dir, err)
+		}
+	}
+
+	r.watcher = watcher
+
+	go r.run()
+
+	return nil
+}
+
+func (r *certReloader) run() {
+
+	for {
+		select {
+			case event, ok := <-r.watcher.Events:
+				if !ok {
+					return
+				}
+
+				if !r.affects(event) {
+					continue
+				}
+
+				// Сертификат и ключ могут обновляться не одновременно:
+				// несогласованная пара не загрузится до следующего события
+				if err := r.load(); err != nil {
+					r.logger.Warnf("reload certificate: %s", err)
+					continue
+				}
+
+				r.logger.Infof("certificate reloaded: %s", event.Name)
+
+			case err, ok := <-r.watcher.Errors:
+				if !ok {
+					return
+				}
+
+				r.logger.Errorf("certificate watcher: %s", err)
+		}
+	}
+}
+
+// Событие относится к файлам сертификата, ключа или CA либо к служебным
+// файлам kubernetes (..data), через которые они подменяются
+func (r *certReloader) affects(event fsnotify.Event) bool {
+
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) &&
+		!event.Has(fsnotify.Rename) {
+		return false
+	}
+
+	name := filepath.Clean(event.Name)
+
+	return name == filepath.Clean(r.certFile) ||
+		name == filepath.Clean(r.keyFile) ||
+		(r.caFile != "" && name == filepath.Clean(r.caFile)) ||
+		strings.HasPrefix(filepath.Base(name), "..")
+}
+
+func (r *certReloader) Close() error {
+
+	if r.watcher == nil {
+		return nil
+	}
+
+	return r.watcher.Close()
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"os"
+	"time"
+	"testing"
+	"math/big"
+	"crypto/tls"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/ecdsa"
+	"encoding/pem"
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"path/filepath"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Выпускает самоподписанный сертификат и возвращает его и ключ в PEM
+func selfSigned(t *testing.T, commonName string, isCa bool) ([]byte, []byte) {
+
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: commonName},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: isCa,
+		BasicConstraintsValid: isCa,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// Заменяет файл переименованием, как это делают при ротации секретов
+func replaceFile(t *testing.T, name string, data []byte) {
+
+	t.Helper()
+
+	tmp := name + ".tmp"
+
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writePair(t *testing.T, certFile, keyFile, commonName string) {
+
+	t.Helper()
+
+	cert, key := selfSigned(t, commonName, false)
+
+	replaceFile(t, certFile, cert)
+	replaceFile(t, keyFile, key)
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.Subject.CommonName
+}
+
+// Ждет выполнения условия, которое наступает после события fsnotify
+func eventually(t *testing.T, condition func() bool) {
+
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !condition() {
+
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// После замены файлов GetCertificate отдает новый сертификат,
+// а несогласованная пара не заменяет прежний
+func TestCertReloader(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+
+	writePair(t, certFile, keyFile, "first")
+
+	r, err := newCertReloader(certFile, keyFile, "", log.NewLogrusLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cert, _ := r.GetCertificate(nil)
+	if name := commonName(t, cert); name != "first" {
+		t.Fatalf("common name = %q, want first", name)
+	}
+
+	writePair(t, certFile, keyFile, "second")
+
+	eventually(t, func() bool {
+		cert, _ := r.GetCertificate(nil)
+		return commonName(t, cert) == "second"
+	})
+
+	// Сертификат от другого ключа не загружается
+	foreign, _ := selfSigned(t, "foreign", false)
+	if err := os.WriteFile(certFile, foreign, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.load(); err == nil {
+		t.Fatal("mismatched pair loaded")
+	}
+
+	cert, _ = r.GetCertificate(nil)
+	if name := commonName(t, cert); name != "second" {
+		t.Fatalf("common name = %q, want second", name)
+	}
+}
+
+// CA сертификатов клиентов тоже перечитывается и применяется
+// к новым соединениям
+func TestClientCaReload(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "clients-ca.pem")
+
+	writePair(t, certFile, keyFile, "server")
+
+	first, _ := selfSigned(t, "first-ca", true)
+	replaceFile(t, caFile, first)
+
+	config, r, err := (&TlsConfig{
+		CertFile: certFile,
+		KeyFile: keyFile,
+		ClientCaFile: caFile,
+		ClientAuth: ClientAuthOptional,
+	}).build(log.NewLogrusLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	clientCAs := func() *x509.CertPool {
+
+		conf, err := config.GetConfigForClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return conf.ClientCAs
+	}
+
+	firstPool, err := loadCertPool(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !clientCAs().Equal(firstPool) {
+		t.Fatal("initial client ca not used")
+	}
+
+	second, _ := selfSigned(t, "second-ca", true)
+	replaceFile(t, caFile, second)
+
+	secondPool, err := loadCertPool(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool {
+		return clientCAs().Equal(secondPool)
+	})
+}
@@ -15,11 +15,17 @@ type HttpConfig struct {
 	MaxHeaderBytes	int
 	ReadTimeout		time.Duration
 	WriteTimeout	time.Duration
+
+	// nil - сервер работает без TLS
+	Tls				*TlsConfig
 }
 
 type Http struct {
 	logger		log.Logger
 	httpServer	*http.Server
+
+	// Перечитывает сертификат TLS при изменении файлов
+	certReloader	*certReloader
 }
 
 func NewHttp(logger log.Logger) *Http {
@@ -38,9 +44,33 @@ func (s *Http) Run(errChan chan error, conf *HttpConfig) {
 		WriteTimeout:	conf.WriteTimeout * time.Second,
 	}
 
-	s.logger.Infof("Starting HTTP server on port %d...\n", conf.Port)
+	var err error
+
+	if conf.Tls != nil {
+
+		s.httpServer.TLSConfig, s.certReloader, err = conf.Tls.build(s.logger)
+		if err != nil {
+			errChan <- fmt.Errorf("configure tls: %s\n", err)
+			return
+		}
+
+		if err := s.certReloader.Watch(); err != nil {
+			errChan <- fmt.Errorf("watch certificate: %s\n", err)
+			return
+		}
+
+		s.logger.Infof("Starting HTTPS server on port %d...\n", conf.Port)
+
+		// Сертификат выдается через TLSConfig.GetCertificate
+		err = s.httpServer.ListenAndServeTLS("", "")
+
+	} else {
+
+		s.logger.Infof("Starting HTTP server on port %d...\n", conf.Port)
+
+		err = s.httpServer.ListenAndServe()
+	}
 
-	err := s.httpServer.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		errChan <- fmt.Errorf("start http server error: %s\n", err)
 	}
@@ -56,5 +86,11 @@ func (s *Http) Shutdown() error {
 
 	defer cancel()
 
+	if s.certReloader != nil {
+		if err := s.certReloader.Close(); err != nil {
+			s.logger.Error(err)
+		}
+	}
+
 	return s.httpServer.Shutdown(ctx)
 }
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"crypto/tls"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Режимы запроса сертификата клиента (mTLS)
+const (
+	ClientAuthNone		= "none"
+	ClientAuthOptional	= "optional" // проверяется, если предъявлен
+	ClientAuthRequire	= "require"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+type TlsConfig struct {
+	CertFile		string
+	KeyFile			string
+
+	// Минимальная версия TLS: 1.2 или 1.3 (пустая - 1.2)
+	MinVersion		string
+
+	// Наборы шифров TLS 1.2 по именам Go (пустой - наборы по умолчанию).
+	// Для TLS 1.3 наборы шифров не настраиваются
+	CipherSuites	[]string
+
+	// CA для проверки сертификатов клиентов (пустой - без mTLS)
+	ClientCaFile	string
+	ClientAuth		string
+}
+
+// Сертификат сервера и CA клиентов загружаются через certReloader,
+// который подменяет их при изменении файлов. Текущий CA подставляется
+// в конфигурацию каждого соединения через GetConfigForClient
+func (c *TlsConfig) build(logger log.Logger) (*tls.Config, *certReloader, error) {
+
+	minVersion := uint16(tls.VersionTLS12)
+
+	if c.MinVersion != "" {
+
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported tls version: %s", c.MinVersion)
+		}
+
+		minVersion = version
+	}
+
+	cipherSuites, err := parseCipherSuites(c.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientAuth, err := c.clientAuth()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caFile := ""
+	if clientAuth != tls.NoClientCert {
+		caFile = c.ClientCaFile
+	}
+
+	reloader, err := newCertReloader(c.CertFile, c.KeyFile, caFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion: minVersion,
+		CipherSuites: cipherSuites,
+		ClientCAs: reloader.ClientCAs(),
+		ClientAuth: clientAuth,
+	}
+
+	if caFile != "" {
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+
+			conf := config.Clone()
+			conf.ClientCAs = reloader.ClientCAs()
+
+			return conf, nil
+		}
+	}
+
+	return config, reloader, nil
+}
+
+func (c *TlsConfig) clientAuth() (tls.ClientAuthType, error) {
+
+	if c.ClientCaFile == "" || c.ClientAuth == ClientAuthNone {
+		return tls.NoClientCert, nil
+	}
+
+	switch c.ClientAuth {
+		case ClientAuthOptional:
+			return tls.VerifyClientCertIfGiven, nil
+
+		case ClientAuthRequire:
+			return tls.RequireAndVerifyClientCert, nil
+
+		default:
+			return 0, fmt.Errorf("unknown client auth: %s", c.ClientAuth)
+	}
+}
+
+// Допускаются только наборы шифров без известных уязвимостей
+func parseCipherSuites(names []string) ([]uint16, error) {
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	supported := map[string]uint16{}
+
+	for _, suite := range tls.CipherSuites() {
+		supported[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+
+	for _, name := range names {
+
+		id, ok := supported[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported cipher suite: %s", name)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
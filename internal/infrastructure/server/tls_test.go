@@ -0,0 +1,69 @@
+package server
+
+import (
+	"testing"
+	"crypto/tls"
+	"path/filepath"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+func TestTlsConfigValidation(t *testing.T) {
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+
+	writePair(t, certFile, keyFile, "server")
+
+	cases := []struct {
+		name			string
+		minVersion		string
+		cipherSuites	[]string
+		wantErr			bool
+		wantVersion		uint16
+	}{
+		{"defaults", "", nil, false, tls.VersionTLS12},
+		{"tls 1.3", "1.3", nil, false, tls.VersionTLS13},
+		{"tls 1.1", "1.1", nil, true, 0},
+		{"unknown version", "tls1.3", nil, true, 0},
+		{
+			"secure suites",
+			"1.2",
+			[]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			false,
+			tls.VersionTLS12,
+		},
+		{"unknown suite", "", []string{"TLS_UNKNOWN"}, true, 0},
+		{"insecure suite", "", []string{"TLS_RSA_WITH_RC4_128_SHA"}, true, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			config, r, err := (&TlsConfig{
+				CertFile: certFile,
+				KeyFile: keyFile,
+				MinVersion: c.minVersion,
+				CipherSuites: c.cipherSuites,
+			}).build(log.NewLogrusLogger())
+
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, want error %v", err, c.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+			defer r.Close()
+
+			if config.MinVersion != c.wantVersion {
+				t.Fatalf("min version = %x, want %x", config.MinVersion, c.wantVersion)
+			}
+
+			if len(config.CipherSuites) != len(c.cipherSuites) {
+				t.Fatalf("cipher suites = %v, want %v", config.CipherSuites, c.cipherSuites)
+			}
+		})
+	}
+}
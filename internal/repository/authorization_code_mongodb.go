@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"time"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+type AuthorizationCodeDocument struct {
+	Hash			string		`bson:"_id"`
+	ClientId		string		`bson:"client_id"`
+	RedirectUri		string		`bson:"redirect_uri"`
+	RedirectUriExplicit	bool	`bson:"redirect_uri_explicit,omitempty"`
+	Uuid			string		`bson:"uuid"`
+	Scope			string		`bson:"scope,omitempty"`
+	CodeChallenge	string		`bson:"code_challenge"`
+	Nonce			string		`bson:"nonce,omitempty"`
+	AuthTime		time.Time	`bson:"auth_time"`
+	ExpireAt		time.Time	`bson:"expire_at"`
+}
+
+func (d *AuthorizationCodeDocument) entity() *entity.AuthorizationCode {
+	return &entity.AuthorizationCode{
+		Hash: d.Hash,
+		ClientId: d.ClientId,
+		RedirectUri: d.RedirectUri,
+		RedirectUriExplicit: d.RedirectUriExplicit,
+		Uuid: d.Uuid,
+		Scope: d.Scope,
+		CodeChallenge: d.CodeChallenge,
+		Nonce: d.Nonce,
+		AuthTime: d.AuthTime,
+		ExpireAt: d.ExpireAt,
+	}
+}
+
+type AuthorizationCodeRepositoryMongo struct {
+
+	database	*mongo.Database
+	collection	*mongo.Collection
+
+	logger		log.Logger
+}
+
+func NewAuthorizationCodeRepositoryMongo(
+	database *mongo.Database,
+	logger log.Logger,
+) *AuthorizationCodeRepositoryMongo {
+	return &AuthorizationCodeRepositoryMongo{
+		database: database,
+		collection: database.Collection("authorization_codes"),
+		logger: logger,
+	}
+}
+
+// Создает TTL индекс: неиспользованные коды удаляются после истечения срока
+func (a *AuthorizationCodeRepositoryMongo) CreateIndexes(
+	ctx context.Context,
+) error {
+
+	_, err := a.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	if err != nil {
+		a.logger.Errorf("create indexes: %s", err)
+
+		return errors.Internal.New("create indexes").Wrap(err)
+	}
+
+	return nil
+}
+
+func (a *AuthorizationCodeRepositoryMongo) Save(
+	ctx context.Context,
+	code *entity.AuthorizationCode,
+) error {
+
+	_, err := a.collection.InsertOne(ctx, AuthorizationCodeDocument{
+		Hash: code.Hash,
+		ClientId: code.ClientId,
+		RedirectUri: code.RedirectUri,
+		RedirectUriExplicit: code.RedirectUriExplicit,
+		Uuid: code.Uuid,
+		Scope: code.Scope,
+		CodeChallenge: code.CodeChallenge,
+		Nonce: code.Nonce,
+		AuthTime: code.AuthTime,
+		ExpireAt: code.ExpireAt,
+	})
+
+	if err != nil {
+		a.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Errorf("insert code: %s", err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	return nil
+}
+
+// Атомарно извлекает и удаляет код: повторно использовать его нельзя
+func (a *AuthorizationCodeRepositoryMongo) Consume(
+	ctx context.Context,
+	hash string,
+) (*entity.AuthorizationCode, error) {
+
+	var data AuthorizationCodeDocument
+
+	err := a.collection.FindOneAndDelete(ctx, bson.M{"_id": hash}).Decode(&data)
+	if err != nil {
+
+		logger := a.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		})
+
+		if err == mongo.ErrNoDocuments {
+			logger.Warn(err)
+
+			return nil, errors.NotFound.New("code not found").Wrap(err)
+		}
+
+		logger.Error(err)
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return data.entity(), nil
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"os"
+	"fmt"
+	"context"
+	"encoding/json"
+
+	"github.com/amaretur/auth-service/internal/entity"
+)
+
+type userClaimsFile struct {
+	Roles		[]string	`json:"roles"`
+	Permissions	[]string	`json:"permissions"`
+	Scopes		[]string	`json:"scopes"`
+}
+
+func (u *userClaimsFile) entity() *entity.UserClaims {
+	return &entity.UserClaims{
+		Roles: u.Roles,
+		Permissions: u.Permissions,
+		Scopes: u.Scopes,
+	}
+}
+
+// Полномочия пользователей из JSON файла: default применяется
+// к пользователям, не перечисленным в users
+type ClaimsFile struct {
+	Default	userClaimsFile				`json:"default"`
+	Users	map[string]userClaimsFile	`json:"users"`
+}
+
+// Загружает полномочия из файла. Если путь не указан,
+// пользователи не получают ни ролей, ни областей доступа
+func NewClaimsFile(path string) (*ClaimsFile, error) {
+
+	claims := &ClaimsFile{}
+
+	if path == "" {
+		return claims, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read claims file: %s", err)
+	}
+
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, fmt.Errorf("parse claims file: %s", err)
+	}
+
+	return claims, nil
+}
+
+func (c *ClaimsFile) Claims(
+	ctx context.Context,
+	uuid string,
+) (*entity.UserClaims, error) {
+
+	if user, ok := c.Users[uuid]; ok {
+		return user.entity(), nil
+	}
+
+	return c.Default.entity(), nil
+}
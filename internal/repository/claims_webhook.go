@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+	"bytes"
+	"context"
+	"net/http"
+	"encoding/json"
+
+	"github.com/amaretur/auth-service/internal/entity"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+const (
+	// При ошибке вебхука токен выдается без дополнительных утверждений
+	WebhookFallbackSkip	= "skip"
+
+	// При ошибке вебхука выдача токена завершается ошибкой
+	WebhookFallbackFail	= "fail"
+)
+
+type enrichWebhookRequest struct {
+	Sub			string		`json:"sub"`
+	ClientId	string		`json:"client_id,omitempty"`
+	Scopes		[]string	`json:"scopes,omitempty"`
+}
+
+// Запрашивает дополнительные утверждения токена у внешнего сервиса.
+// Вебхук получает POST запрос с JSON телом {sub, client_id, scopes}
+// и возвращает JSON объект с утверждениями
+type ClaimsWebhook struct {
+	url			string
+	fallback	string
+	client		*http.Client
+
+	logger		log.Logger
+}
+
+func NewClaimsWebhook(
+	url string,
+	timeout time.Duration,
+	fallback string,
+	logger log.Logger,
+) *ClaimsWebhook {
+	return &ClaimsWebhook{
+		url: url,
+		fallback: fallback,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		logger: logger.WithFields(map[string]any{
+			"unit": "claims_webhook",
+		}),
+	}
+}
+
+func (c *ClaimsWebhook) Enrich(
+	ctx context.Context,
+	request *entity.EnrichRequest,
+) (map[string]any, error) {
+
+	claims, err := c.call(ctx, request)
+	if err != nil {
+
+		if c.fallback == WebhookFallbackSkip {
+
+			c.logger.WithFields(map[string]any{
+				"req_id": reqid.FromContext(ctx),
+			}).Warnf("call webhook, claims skipped: %s", err)
+
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (c *ClaimsWebhook) call(
+	ctx context.Context,
+	request *entity.EnrichRequest,
+) (map[string]any, error) {
+
+	body, err := json.Marshal(&enrichWebhookRequest{
+		Sub: request.Uuid,
+		ClientId: request.ClientId,
+		Scopes: request.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		c.url,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", reqid.FromContext(ctx))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var claims map[string]any
+
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("decode response: %s", err)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+)
+
+// Реестр клиентов в памяти процесса (заполняется из конфигурации)
+type ClientRepositoryMemory struct {
+	clients map[string]*entity.Client
+}
+
+func NewClientRepositoryMemory(
+	clients []*entity.Client,
+) *ClientRepositoryMemory {
+
+	m := make(map[string]*entity.Client, len(clients))
+
+	for _, c := range clients {
+		m[c.Id] = c
+	}
+
+	return &ClientRepositoryMemory{
+		clients: m,
+	}
+}
+
+func (c *ClientRepositoryMemory) GetById(
+	ctx context.Context,
+	id string,
+) (*entity.Client, error) {
+
+	client, ok := c.clients[id]
+	if !ok {
+		return nil, errors.NotFound.New("client not found")
+	}
+
+	return client, nil
+}
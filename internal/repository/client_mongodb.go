@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"time"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Сроки жизни токенов хранятся в минутах
+type ClientDocument struct {
+	Id				string		`bson:"_id"`
+	SecretHash		string		`bson:"secret_hash"`
+	GrantTypes		[]string	`bson:"grant_types,omitempty"`
+	Scopes			[]string	`bson:"scopes,omitempty"`
+	Audience		[]string	`bson:"audience,omitempty"`
+	RedirectUris	[]string	`bson:"redirect_uris,omitempty"`
+	Public			bool		`bson:"public,omitempty"`
+	TlsSubjectDn	string		`bson:"tls_client_auth_subject_dn,omitempty"`
+	TlsSanDns		string		`bson:"tls_client_auth_san_dns,omitempty"`
+	AccessExpire	int64		`bson:"access_expire,omitempty"`
+	RefreshExpire	int64		`bson:"refresh_expire,omitempty"`
+
+	AccessTokenFormat	string	`bson:"access_token_format,omitempty"`
+}
+
+func (d *ClientDocument) entity() *entity.Client {
+	return &entity.Client{
+		Id: d.Id,
+		SecretHash: d.SecretHash,
+		GrantTypes: d.GrantTypes,
+		Scopes: d.Scopes,
+		Audience: d.Audience,
+		RedirectUris: d.RedirectUris,
+		Public: d.Public,
+		TlsSubjectDn: d.TlsSubjectDn,
+		TlsSanDns: d.TlsSanDns,
+		AccessExpire: time.Duration(d.AccessExpire),
+		RefreshExpire: time.Duration(d.RefreshExpire),
+		AccessTokenFormat: d.AccessTokenFormat,
+	}
+}
+
+// Реестр клиентов в MongoDB (коллекция clients)
+type ClientRepositoryMongo struct {
+
+	database	*mongo.Database
+	collection	*mongo.Collection
+
+	logger		log.Logger
+}
+
+func NewClientRepositoryMongo(
+	database *mongo.Database,
+	logger log.Logger,
+) *ClientRepositoryMongo {
+	return &ClientRepositoryMongo{
+		database: database,
+		collection: database.Collection("clients"),
+		logger: logger,
+	}
+}
+
+func (c *ClientRepositoryMongo) GetById(
+	ctx context.Context,
+	id string,
+) (*entity.Client, error) {
+
+	var data ClientDocument
+
+	err := c.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&data)
+	if err != nil {
+
+		logger := c.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"client_id": id,
+		})
+
+		if err == mongo.ErrNoDocuments {
+			logger.Warn(err)
+
+			return nil, errors.NotFound.New("client not found").Wrap(err)
+		}
+
+		logger.Error(err)
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return data.entity(), nil
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"sync"
+	"time"
+	"context"
+)
+
+type denylist interface {
+	Add(ctx context.Context, jti string, expireAt time.Time) error
+	Contains(ctx context.Context, jti string) (bool, error)
+}
+
+// Кеш в памяти процесса перед хранилищем отозванных токенов.
+// Отозванные токены кешируются до истечения их срока (он не может
+// превышать maxTokenAge), неотозванные - на ttl. Отзыв, выполненный
+// другим экземпляром приложения, становится виден не позднее чем через ttl
+type DenylistCache struct {
+	store		denylist
+
+	ttl			time.Duration
+	maxTokenAge	time.Duration
+
+	mu			sync.Mutex
+	denied		map[string]time.Time // jti -> до какого момента запись верна
+	allowed		map[string]time.Time
+
+	cleanupAt	time.Time
+}
+
+func NewDenylistCache(
+	store denylist,
+	ttl time.Duration,
+	maxTokenAge time.Duration,
+) *DenylistCache {
+	return &DenylistCache{
+		store: store,
+		ttl: ttl,
+		maxTokenAge: maxTokenAge,
+		denied: map[string]time.Time{},
+		allowed: map[string]time.Time{},
+	}
+}
+
+func (c *DenylistCache) Add(
+	ctx context.Context,
+	jti string,
+	expireAt time.Time,
+) error {
+
+	if err := c.store.Add(ctx, jti, expireAt); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.denied[jti] = expireAt
+	delete(c.allowed, jti)
+
+	return nil
+}
+
+func (c *DenylistCache) Contains(
+	ctx context.Context,
+	jti string,
+) (bool, error) {
+
+	if denied, ok := c.cached(jti); ok {
+		return denied, nil
+	}
+
+	denied, err := c.store.Contains(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if denied {
+		c.denied[jti] = now.Add(c.maxTokenAge)
+	} else {
+		c.allowed[jti] = now.Add(c.ttl)
+	}
+
+	c.cleanup(now)
+
+	return denied, nil
+}
+
+// Возвращает закешированный ответ, если он есть и еще актуален
+func (c *DenylistCache) cached(jti string) (bool, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if until, ok := c.denied[jti]; ok && now.Before(until) {
+		return true, true
+	}
+
+	if until, ok := c.allowed[jti]; ok && now.Before(until) {
+		return false, true
+	}
+
+	return false, false
+}
+
+// Удаляет устаревшие записи не чаще одного раза в минуту
+func (c *DenylistCache) cleanup(now time.Time) {
+
+	if now.Before(c.cleanupAt) {
+		return
+	}
+
+	for _, entries := range []map[string]time.Time{c.denied, c.allowed} {
+		for jti, until := range entries {
+			if !now.Before(until) {
+				delete(entries, jti)
+			}
+		}
+	}
+
+	c.cleanupAt = now.Add(time.Minute)
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"sync"
+	"time"
+	"context"
+)
+
+// Список отозванных токенов в памяти процесса. Подходит для запуска
+// в единственном экземпляре; записи теряются при перезапуске
+type DenylistMemory struct {
+	mu			sync.Mutex
+	entries		map[string]time.Time // jti -> момент истечения
+
+	cleanupAt	time.Time // момент следующей очистки истекших записей
+}
+
+func NewDenylistMemory() *DenylistMemory {
+	return &DenylistMemory{
+		entries: map[string]time.Time{},
+	}
+}
+
+func (d *DenylistMemory) Add(
+	ctx context.Context,
+	jti string,
+	expireAt time.Time,
+) error {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[jti] = expireAt
+
+	d.cleanup()
+
+	return nil
+}
+
+func (d *DenylistMemory) Contains(
+	ctx context.Context,
+	jti string,
+) (bool, error) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expireAt, ok := d.entries[jti]
+
+	return ok && time.Now().Before(expireAt), nil
+}
+
+// Удаляет истекшие записи не чаще одного раза в минуту
+func (d *DenylistMemory) cleanup() {
+
+	now := time.Now()
+
+	if now.Before(d.cleanupAt) {
+		return
+	}
+
+	for jti, expireAt := range d.entries {
+		if !now.Before(expireAt) {
+			delete(d.entries, jti)
+		}
+	}
+
+	d.cleanupAt = now.Add(time.Minute)
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"time"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+type DenylistDocument struct {
+	Jti			string		`bson:"_id"`
+	ExpireAt	time.Time	`bson:"expire_at"`
+}
+
+type DenylistMongo struct {
+
+	database	*mongo.Database
+	collection	*mongo.Collection
+
+	logger		log.Logger
+}
+
+func NewDenylistMongo(
+	database *mongo.Database,
+	logger log.Logger,
+) *DenylistMongo {
+	return &DenylistMongo{
+		database: database,
+		collection: database.Collection("denylist"),
+		logger: logger,
+	}
+}
+
+// Создает TTL индекс: запись удаляется после истечения срока токена
+func (d *DenylistMongo) CreateIndexes(ctx context.Context) error {
+
+	_, err := d.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	if err != nil {
+		d.logger.Errorf("create indexes: %s", err)
+
+		return errors.Internal.New("create indexes").Wrap(err)
+	}
+
+	return nil
+}
+
+func (d *DenylistMongo) Add(
+	ctx context.Context,
+	jti string,
+	expireAt time.Time,
+) error {
+
+	_, err := d.collection.ReplaceOne(
+		ctx,
+		bson.M{"_id": jti},
+		DenylistDocument{Jti: jti, ExpireAt: expireAt},
+		options.Replace().SetUpsert(true),
+	)
+
+	if err != nil {
+		d.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Errorf("upsert jti: %s", err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	return nil
+}
+
+func (d *DenylistMongo) Contains(
+	ctx context.Context,
+	jti string,
+) (bool, error) {
+
+	// TTL индекс удаляет документы с задержкой,
+	// поэтому срок действия проверяется явно
+	filter := bson.M{
+		"_id": jti,
+		"expire_at": bson.M{"$gt": time.Now()},
+	}
+
+	count, err := d.collection.CountDocuments(
+		ctx,
+		filter,
+		options.Count().SetLimit(1),
+	)
+
+	if err != nil {
+		d.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"jti": jti,
+		}).Error(err)
+
+		return false, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return count > 0, nil
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"sync"
+	"time"
+	"context"
+)
+
+// Использованные jti DPoP доказательств в памяти процесса. Подходит
+// для запуска в единственном экземпляре; записи теряются при перезапуске
+type DPoPReplayMemory struct {
+	mu			sync.Mutex
+	entries		map[string]time.Time // jti -> момент истечения
+
+	cleanupAt	time.Time // момент следующей очистки истекших записей
+}
+
+func NewDPoPReplayMemory() *DPoPReplayMemory {
+	return &DPoPReplayMemory{
+		entries: map[string]time.Time{},
+	}
+}
+
+func (d *DPoPReplayMemory) Use(
+	ctx context.Context,
+	jti string,
+	expireAt time.Time,
+) (bool, error) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.cleanup()
+
+	if prev, ok := d.entries[jti]; ok && time.Now().Before(prev) {
+		return false, nil
+	}
+
+	d.entries[jti] = expireAt
+
+	return true, nil
+}
+
+// Удаляет истекшие записи не чаще одного раза в минуту
+func (d *DPoPReplayMemory) cleanup() {
+
+	now := time.Now()
+
+	if now.Before(d.cleanupAt) {
+		return
+	}
+
+	for jti, expireAt := range d.entries {
+		if !now.Before(expireAt) {
+			delete(d.entries, jti)
+		}
+	}
+
+	d.cleanupAt = now.Add(time.Minute)
+}
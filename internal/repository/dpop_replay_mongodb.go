@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"time"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+type DPoPReplayDocument struct {
+	Jti			string		`bson:"_id"`
+	ExpireAt	time.Time	`bson:"expire_at"`
+}
+
+type DPoPReplayMongo struct {
+
+	database	*mongo.Database
+	collection	*mongo.Collection
+
+	logger		log.Logger
+}
+
+func NewDPoPReplayMongo(
+	database *mongo.Database,
+	logger log.Logger,
+) *DPoPReplayMongo {
+	return &DPoPReplayMongo{
+		database: database,
+		collection: database.Collection("dpop_jti"),
+		logger: logger,
+	}
+}
+
+// Создает TTL индекс: запись удаляется, когда доказательство
+// с этим jti уже не может быть принято по сроку
+func (d *DPoPReplayMongo) CreateIndexes(ctx context.Context) error {
+
+	_, err := d.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	if err != nil {
+		d.logger.Errorf("create indexes: %s", err)
+
+		return errors.Internal.New("create indexes").Wrap(err)
+	}
+
+	return nil
+}
+
+// Вставка по уникальному _id атомарна: из одновременных запросов
+// с одним jti успешен только один
+func (d *DPoPReplayMongo) Use(
+	ctx context.Context,
+	jti string,
+	expireAt time.Time,
+) (bool, error) {
+
+	_, err := d.collection.InsertOne(ctx, DPoPReplayDocument{
+		Jti: jti,
+		ExpireAt: expireAt,
+	})
+
+	if err != nil {
+
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+
+		d.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Errorf("insert jti: %s", err)
+
+		return false, errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"sync"
+	"time"
+	"context"
+)
+
+type notBeforeStore interface {
+	Set(
+		ctx context.Context,
+		uuid string,
+		notBefore time.Time,
+		expire time.Duration,
+	) error
+
+	Get(ctx context.Context, uuid string) (time.Time, error)
+}
+
+type notBeforeEntry struct {
+	notBefore	time.Time
+	until		time.Time // до какого момента запись верна
+}
+
+// Кеш в памяти процесса перед хранилищем моментов отзыва всех токенов
+// пользователя: без него каждый разбор access токена обращается к БД.
+// Отзыв, выполненный другим экземпляром приложения, становится виден
+// не позднее чем через ttl
+type NotBeforeCache struct {
+	store		notBeforeStore
+
+	ttl			time.Duration
+
+	mu			sync.Mutex
+	entries		map[string]notBeforeEntry
+
+	cleanupAt	time.Time
+}
+
+func NewNotBeforeCache(store notBeforeStore, ttl time.Duration) *NotBeforeCache {
+	return &NotBeforeCache{
+		store: store,
+		ttl: ttl,
+		entries: map[string]notBeforeEntry{},
+	}
+}
+
+func (c *NotBeforeCache) Set(
+	ctx context.Context,
+	uuid string,
+	notBefore time.Time,
+	expire time.Duration,
+) error {
+
+	if err := c.store.Set(ctx, uuid, notBefore, expire); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[uuid] = notBeforeEntry{
+		notBefore: notBefore,
+		until: time.Now().Add(c.ttl),
+	}
+
+	return nil
+}
+
+func (c *NotBeforeCache) Get(
+	ctx context.Context,
+	uuid string,
+) (time.Time, error) {
+
+	if notBefore, ok := c.cached(uuid); ok {
+		return notBefore, nil
+	}
+
+	notBefore, err := c.store.Get(ctx, uuid)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	c.entries[uuid] = notBeforeEntry{
+		notBefore: notBefore,
+		until: now.Add(c.ttl),
+	}
+
+	c.cleanup(now)
+
+	return notBefore, nil
+}
+
+// Возвращает закешированный момент отзыва, если запись еще актуальна
+func (c *NotBeforeCache) cached(uuid string) (time.Time, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[uuid]
+	if !ok || !time.Now().Before(entry.until) {
+		return time.Time{}, false
+	}
+
+	return entry.notBefore, true
+}
+
+// Удаляет устаревшие записи не чаще одного раза в минуту
+func (c *NotBeforeCache) cleanup(now time.Time) {
+
+	if now.Before(c.cleanupAt) {
+		return
+	}
+
+	for uuid, entry := range c.entries {
+		if !now.Before(entry.until) {
+			delete(c.entries, uuid)
+		}
+	}
+
+	c.cleanupAt = now.Add(time.Minute)
+}
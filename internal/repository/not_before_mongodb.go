@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"time"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Момент времени (с точностью до секунды), раньше которого выданные
+// пользователю access токены считаются отозванными
+type NotBeforeDocument struct {
+	Uuid		string		`bson:"_id"`
+	NotBefore	time.Time	`bson:"not_before"`
+	ExpireAt	time.Time	`bson:"expire_at"`
+}
+
+type NotBeforeRepositoryMongo struct {
+
+	database	*mongo.Database
+	collection	*mongo.Collection
+
+	logger		log.Logger
+}
+
+func NewNotBeforeRepositoryMongo(
+	database *mongo.Database,
+	logger log.Logger,
+) *NotBeforeRepositoryMongo {
+	return &NotBeforeRepositoryMongo{
+		database: database,
+		collection: database.Collection("not_before"),
+		logger: logger,
+	}
+}
+
+// Создает TTL индекс: запись не нужна после истечения
+// всех выданных до нее токенов
+func (n *NotBeforeRepositoryMongo) CreateIndexes(ctx context.Context) error {
+
+	_, err := n.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	if err != nil {
+		n.logger.Errorf("create indexes: %s", err)
+
+		return errors.Internal.New("create indexes").Wrap(err)
+	}
+
+	return nil
+}
+
+func (n *NotBeforeRepositoryMongo) Set(
+	ctx context.Context,
+	uuid string,
+	notBefore time.Time,
+	expire time.Duration,
+) error {
+
+	document := NotBeforeDocument{
+		Uuid: uuid,
+		NotBefore: notBefore,
+		ExpireAt: notBefore.Add(time.Minute * expire),
+	}
+
+	_, err := n.collection.ReplaceOne(
+		ctx,
+		bson.M{"_id": uuid},
+		document,
+		options.Replace().SetUpsert(true),
+	)
+
+	if err != nil {
+		n.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Errorf("upsert not before: %s", err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	return nil
+}
+
+// Возвращает момент отзыва токенов пользователя.
+// Если токены не отзывались, возвращает нулевое время
+func (n *NotBeforeRepositoryMongo) Get(
+	ctx context.Context,
+	uuid string,
+) (time.Time, error) {
+
+	var data NotBeforeDocument
+
+	err := n.collection.FindOne(ctx, bson.M{"_id": uuid}).Decode(&data)
+	if err != nil {
+
+		if err == mongo.ErrNoDocuments {
+			return time.Time{}, nil
+		}
+
+		n.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"uuid": uuid,
+		}).Error(err)
+
+		return time.Time{}, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return data.NotBefore, nil
+}
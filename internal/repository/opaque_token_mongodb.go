@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"time"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+type OpaqueTokenDocument struct {
+	Lookup		string		`bson:"_id"`
+	Claims		[]byte		`bson:"claims"`
+	ExpireAt	time.Time	`bson:"expire_at"`
+}
+
+func (d *OpaqueTokenDocument) entity() *entity.OpaqueToken {
+	return &entity.OpaqueToken{
+		Lookup: d.Lookup,
+		Claims: d.Claims,
+		ExpireAt: d.ExpireAt,
+	}
+}
+
+type OpaqueTokenMongo struct {
+
+	database	*mongo.Database
+	collection	*mongo.Collection
+
+	logger		log.Logger
+}
+
+func NewOpaqueTokenMongo(
+	database *mongo.Database,
+	logger log.Logger,
+) *OpaqueTokenMongo {
+	return &OpaqueTokenMongo{
+		database: database,
+		collection: database.Collection("opaque_tokens"),
+		logger: logger,
+	}
+}
+
+// Создает TTL индекс: запись удаляется после истечения срока хранения
+func (o *OpaqueTokenMongo) CreateIndexes(ctx context.Context) error {
+
+	_, err := o.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	if err != nil {
+		o.logger.Errorf("create indexes: %s", err)
+
+		return errors.Internal.New("create indexes").Wrap(err)
+	}
+
+	return nil
+}
+
+func (o *OpaqueTokenMongo) Save(
+	ctx context.Context,
+	token *entity.OpaqueToken,
+) error {
+
+	_, err := o.collection.InsertOne(ctx, OpaqueTokenDocument{
+		Lookup: token.Lookup,
+		Claims: token.Claims,
+		ExpireAt: token.ExpireAt,
+	})
+
+	if err != nil {
+		o.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Errorf("insert token: %s", err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	return nil
+}
+
+func (o *OpaqueTokenMongo) GetByLookup(
+	ctx context.Context,
+	lookup string,
+) (*entity.OpaqueToken, error) {
+
+	// TTL индекс удаляет документы с задержкой,
+	// поэтому срок хранения проверяется явно
+	filter := bson.M{
+		"_id": lookup,
+		"expire_at": bson.M{"$gt": time.Now()},
+	}
+
+	var data OpaqueTokenDocument
+
+	err := o.collection.FindOne(ctx, filter).Decode(&data)
+	if err != nil {
+
+		logger := o.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		})
+
+		if err == mongo.ErrNoDocuments {
+			logger.Warn(err)
+
+			return nil, errors.NotFound.New("token not found").Wrap(err)
+		}
+
+		logger.Error(err)
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return data.entity(), nil
+}
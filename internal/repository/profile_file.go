@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"os"
+	"fmt"
+	"context"
+	"encoding/json"
+)
+
+// Профили пользователей из JSON файла вида {"<uuid>": {"name": ...}}
+type ProfileFile struct {
+	profiles map[string]map[string]any
+}
+
+// Загружает профили из файла. Если путь не указан, профили пусты
+func NewProfileFile(path string) (*ProfileFile, error) {
+
+	p := &ProfileFile{}
+
+	if path == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read profiles file: %s", err)
+	}
+
+	if err := json.Unmarshal(data, &p.profiles); err != nil {
+		return nil, fmt.Errorf("parse profiles file: %s", err)
+	}
+
+	return p, nil
+}
+
+func (p *ProfileFile) Profile(
+	ctx context.Context,
+	uuid string,
+) (map[string]any, error) {
+
+	profile, ok := p.profiles[uuid]
+	if !ok {
+		return map[string]any{}, nil
+	}
+
+	return profile, nil
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"time"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Блокировка создания сессий пользователя. Документ существует, пока
+// блокировка захвачена; locked_until защищает от зависших блокировок
+type SessionLockDocument struct {
+	Uuid		string				`bson:"_id"`
+	Owner		primitive.ObjectID	`bson:"owner"`
+	LockedUntil	time.Time			`bson:"locked_until"`
+}
+
+type SessionLockMongo struct {
+
+	database	*mongo.Database
+	collection	*mongo.Collection
+
+	ttl			time.Duration // максимальное время удержания блокировки
+	retry		time.Duration // интервал повторных попыток захвата
+
+	logger		log.Logger
+}
+
+func NewSessionLockMongo(
+	database *mongo.Database,
+	logger log.Logger,
+) *SessionLockMongo {
+	return &SessionLockMongo{
+		database: database,
+		collection: database.Collection("session_lock"),
+		ttl: 10 * time.Second,
+		retry: 20 * time.Millisecond,
+		logger: logger,
+	}
+}
+
+// Захватывает блокировку пользователя, ожидая ее освобождения другими
+// запросами не дольше, чем позволяет контекст. Возвращает функцию
+// освобождения блокировки
+func (s *SessionLockMongo) Lock(
+	ctx context.Context,
+	uuid string,
+) (func(), error) {
+
+	owner := primitive.NewObjectID()
+
+	for {
+		acquired, err := s.tryLock(ctx, uuid, owner)
+		if err != nil {
+			return nil, err
+		}
+
+		if acquired {
+			return func() { s.unlock(ctx, uuid, owner) }, nil
+		}
+
+		select {
+			case <-ctx.Done():
+				s.logger.WithFields(map[string]any{
+					"req_id": reqid.FromContext(ctx),
+					"uuid": uuid,
+				}).Warn("session lock timeout")
+
+				return nil, errors.Internal.New("session lock timeout").
+					Wrap(ctx.Err())
+
+			case <-time.After(s.retry):
+		}
+	}
+}
+
+// Документ создается, если его нет, или перехватывается, если срок
+// блокировки истек. Если блокировка занята, фильтр не совпадает
+// и upsert завершается ошибкой дублирования ключа
+func (s *SessionLockMongo) tryLock(
+	ctx context.Context,
+	uuid string,
+	owner primitive.ObjectID,
+) (bool, error) {
+
+	now := time.Now()
+
+	filter := bson.M{
+		"_id": uuid,
+		"locked_until": bson.M{"$lt": now},
+	}
+
+	update := bson.M{"$set": bson.M{
+		"owner": owner,
+		"locked_until": now.Add(s.ttl),
+	}}
+
+	_, err := s.collection.UpdateOne(
+		ctx,
+		filter,
+		update,
+		options.Update().SetUpsert(true),
+	)
+
+	if err == nil {
+		return true, nil
+	}
+
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+
+	s.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"uuid": uuid,
+	}).Errorf("lock: %s", err)
+
+	return false, errors.Internal.New("internal repository").Wrap(err)
+}
+
+func (s *SessionLockMongo) unlock(
+	ctx context.Context,
+	uuid string,
+	owner primitive.ObjectID,
+) {
+
+	// Освобождение не должно зависеть от истекшего контекста запроса
+	unlockCtx, cancel := context.WithTimeout(
+		context.Background(), 5*time.Second,
+	)
+	defer cancel()
+
+	filter := bson.M{"_id": uuid, "owner": owner}
+
+	if _, err := s.collection.DeleteOne(unlockCtx, filter); err != nil {
+		s.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"uuid": uuid,
+		}).Errorf("unlock: %s", err)
+	}
+}
@@ -6,8 +6,10 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 
+	"github.com/amaretur/auth-service/internal/entity"
 	"github.com/amaretur/auth-service/internal/errors"
 
 	"github.com/amaretur/auth-service/pkg/log"
@@ -15,8 +17,46 @@ import (
 )
 
 type TokenDocument struct {
-	Token		string		`bson:"token"`
-	ExpireAt	time.Time	`bson:"expire_at"`
+	Id			primitive.ObjectID	`bson:"_id,omitempty"`
+	Token		string				`bson:"token"`
+	Lookup		string				`bson:"lookup,omitempty"`
+	Uuid		string				`bson:"uuid,omitempty"`
+	FamilyId	string				`bson:"family_id,omitempty"`
+	Rotated		bool				`bson:"rotated"`
+	ExpireAt	time.Time			`bson:"expire_at"`
+
+	UserAgent		string		`bson:"user_agent,omitempty"`
+	ClientIp		string		`bson:"client_ip,omitempty"`
+	DeviceName		string		`bson:"device_name,omitempty"`
+	CreatedAt		time.Time	`bson:"created_at,omitempty"`
+	LastRefreshedAt	time.Time	`bson:"last_refreshed_at,omitempty"`
+	SessionExpireAt	time.Time	`bson:"session_expire_at,omitempty"`
+	ClientId		string		`bson:"client_id,omitempty"`
+	Scopes			[]string	`bson:"scopes"`
+	Jkt				string		`bson:"jkt,omitempty"`
+	X5t				string		`bson:"x5t,omitempty"`
+}
+
+func (d *TokenDocument) entity() *entity.RefreshToken {
+	return &entity.RefreshToken{
+		Id: d.Id.Hex(),
+		Token: d.Token,
+		Lookup: d.Lookup,
+		ExpireAt: d.ExpireAt,
+		Uuid: d.Uuid,
+		FamilyId: d.FamilyId,
+		Rotated: d.Rotated,
+		UserAgent: d.UserAgent,
+		ClientIp: d.ClientIp,
+		DeviceName: d.DeviceName,
+		CreatedAt: d.CreatedAt,
+		LastRefreshedAt: d.LastRefreshedAt,
+		SessionExpireAt: d.SessionExpireAt,
+		ClientId: d.ClientId,
+		Scopes: d.Scopes,
+		Jkt: d.Jkt,
+		X5t: d.X5t,
+	}
 }
 
 type TokenRepositoryMongo struct {
@@ -38,15 +78,56 @@ func NewTokenRepositoryMongo(
 	}
 }
 
+// Создает индексы коллекции: TTL индекс для удаления истекших токенов
+// и индексы для поиска токенов по значению, пользователю и семейству
+func (t *TokenRepositoryMongo) CreateIndexes(ctx context.Context) error {
+
+	_, err := t.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "expire_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+		{
+			Keys: bson.D{{Key: "uuid", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "family_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "lookup", Value: 1}},
+		},
+	})
+
+	if err != nil {
+		t.logger.Errorf("create indexes: %s", err)
+
+		return errors.Internal.New("create indexes").Wrap(err)
+	}
+
+	return nil
+}
+
 func (t *TokenRepositoryMongo) Save(
 	ctx context.Context,
-	token string,
-	expire time.Duration,
+	token *entity.RefreshToken,
 ) (string, error) {
 
 	document := TokenDocument{
-		Token: token,
-		ExpireAt: time.Now().Add(time.Minute * expire),
+		Token: token.Token,
+		Lookup: token.Lookup,
+		Uuid: token.Uuid,
+		FamilyId: token.FamilyId,
+		ExpireAt: token.ExpireAt,
+		SessionExpireAt: token.SessionExpireAt,
+		ClientId: token.ClientId,
+		Scopes: sessionScopes(token.Scopes),
+		Jkt: token.Jkt,
+		X5t: token.X5t,
+		UserAgent: token.UserAgent,
+		ClientIp: token.ClientIp,
+		DeviceName: token.DeviceName,
+		CreatedAt: token.CreatedAt,
+		LastRefreshedAt: token.LastRefreshedAt,
 	}
 
 	res, err := t.collection.InsertOne(ctx, document)
@@ -64,18 +145,16 @@ func (t *TokenRepositoryMongo) Save(
 func (t *TokenRepositoryMongo) GetById(
 	ctx context.Context,
 	id string,
-) (string, error) {
+) (*entity.RefreshToken, error) {
 
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return "", errors.Internal.New("invalid object id").Wrap(err)
+		return nil, errors.Internal.New("invalid object id").Wrap(err)
 	}
 
 	filter := bson.M{"_id": objectId}
 
-	var data struct {
-		Token	string	`bson:"token"`
-	}
+	var data TokenDocument
 
 	if err := t.collection.FindOne(ctx, filter).Decode(&data); err != nil {
 
@@ -87,15 +166,44 @@ func (t *TokenRepositoryMongo) GetById(
 		if err == mongo.ErrNoDocuments {
 			logger.Warn(err)
 
-			return "", errors.NotFound.New("token not found").Wrap(err)
+			return nil, errors.NotFound.New("token not found").Wrap(err)
+		}
+
+		logger.Error(err)
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return data.entity(), nil
+}
+
+// Ищет токен по SHA-256 его значения
+func (t *TokenRepositoryMongo) GetByLookup(
+	ctx context.Context,
+	lookup string,
+) (*entity.RefreshToken, error) {
+
+	var data TokenDocument
+
+	err := t.collection.FindOne(ctx, bson.M{"lookup": lookup}).Decode(&data)
+	if err != nil {
+
+		logger := t.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		})
+
+		if err == mongo.ErrNoDocuments {
+			logger.Warn(err)
+
+			return nil, errors.NotFound.New("token not found").Wrap(err)
 		}
 
 		logger.Error(err)
 
-		return "", errors.Internal.NewDefault().Wrap(err)
+		return nil, errors.Internal.NewDefault().Wrap(err)
 	}
 
-	return data.Token, nil
+	return data.entity(), nil
 }
 
 func (t *TokenRepositoryMongo) Delete(
@@ -117,7 +225,209 @@ func (t *TokenRepositoryMongo) Delete(
 		return errors.Internal.New("internal repository").Wrap(err)
 	}
 
-	t.logger.Infof("deleted count: %s", deleteResult.DeletedCount)
+	t.logger.Infof("deleted count: %d", deleteResult.DeletedCount)
+
+	return nil
+}
+
+// Атомарно помечает токен как использованный, если документ все еще
+// содержит указанный хеш и не был использован ранее. Из нескольких
+// одновременных вызовов успешен только один, остальные получают NotFound
+func (t *TokenRepositoryMongo) Consume(
+	ctx context.Context,
+	id string,
+	token string,
+) error {
+
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return errors.Internal.New("invalid object id").Wrap(err)
+	}
+
+	filter := bson.M{
+		"_id": objectId,
+		"token": token,
+		"rotated": bson.M{"$ne": true},
+	}
+
+	update := bson.M{"$set": bson.M{"rotated": true}}
+
+	updateResult, err := t.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		t.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Error(err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	if updateResult.ModifiedCount == 0 {
+		t.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"_id": id,
+		}).Warn("token already consumed")
+
+		return errors.NotFound.New("token not found")
+	}
+
+	return nil
+}
+
+// Удаляет все токены семейства
+func (t *TokenRepositoryMongo) DeleteFamily(
+	ctx context.Context,
+	familyId string,
+) error {
+
+	if familyId == "" {
+		return errors.Internal.New("empty family id")
+	}
+
+	filter := bson.M{"family_id": familyId}
+
+	deleteResult, err := t.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		t.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Error(err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	t.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"family_id": familyId,
+	}).Infof("deleted count: %d", deleteResult.DeletedCount)
+
+	return nil
+}
+
+// Удаляет все токены пользователя
+func (t *TokenRepositoryMongo) DeleteByUuid(
+	ctx context.Context,
+	uuid string,
+) error {
+
+	if uuid == "" {
+		return errors.Internal.New("empty uuid")
+	}
+
+	deleteResult, err := t.collection.DeleteMany(ctx, bson.M{"uuid": uuid})
+	if err != nil {
+		t.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Error(err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	t.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"uuid": uuid,
+	}).Infof("deleted count: %d", deleteResult.DeletedCount)
+
+	return nil
+}
+
+// Возвращает действующие (не использованные и не истекшие) токены
+// пользователя - по одному на каждую сессию. Сессии, превысившие
+// абсолютный срок или не обновлявшиеся с idleSince, не возвращаются
+// (нулевой idleSince - без ограничения бездействия)
+func (t *TokenRepositoryMongo) GetActiveByUuid(
+	ctx context.Context,
+	uuid string,
+	idleSince time.Time,
+) ([]*entity.RefreshToken, error) {
+
+	now := time.Now()
+
+	conditions := bson.A{
+		bson.M{"uuid": uuid},
+		bson.M{"rotated": bson.M{"$ne": true}},
+		bson.M{"expire_at": bson.M{"$gt": now}},
+		after("session_expire_at", now),
+	}
+
+	if !idleSince.IsZero() {
+		conditions = append(conditions, after("last_refreshed_at", idleSince))
+	}
+
+	filter := bson.M{"$and": conditions}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	logger := t.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"uuid": uuid,
+	})
+
+	cursor, err := t.collection.Find(ctx, filter, opts)
+	if err != nil {
+		logger.Error(err)
+
+		return nil, errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	var documents []TokenDocument
+
+	if err := cursor.All(ctx, &documents); err != nil {
+		logger.Error(err)
+
+		return nil, errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	tokens := make([]*entity.RefreshToken, 0, len(documents))
+
+	for i := range documents {
+		tokens = append(tokens, documents[i].entity())
+	}
+
+	return tokens, nil
+}
+
+// Области доступа сохраняются всегда, даже пустые: отсутствие поля
+// отличает сессии, созданные до появления областей доступа
+func sessionScopes(scopes []string) []string {
+
+	if scopes == nil {
+		return []string{}
+	}
+
+	return scopes
+}
+
+// Условие "поле позже момента". Документы без поля или с нулевым
+// значением (выданные до его появления) условию удовлетворяют
+func after(field string, moment time.Time) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{"$gt": moment}},
+		bson.M{field: bson.M{"$exists": false}},
+		bson.M{field: bson.M{"$lt": time.Unix(0, 0)}},
+	}}
+}
+
+// Удаляет все токены семейства, принадлежащего пользователю.
+// Возвращает NotFound, если у пользователя нет такого семейства
+func (t *TokenRepositoryMongo) DeleteUserFamily(
+	ctx context.Context,
+	uuid string,
+	familyId string,
+) error {
+
+	filter := bson.M{"uuid": uuid, "family_id": familyId}
+
+	deleteResult, err := t.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		t.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Error(err)
+
+		return errors.Internal.New("internal repository").Wrap(err)
+	}
+
+	if deleteResult.DeletedCount == 0 {
+		return errors.NotFound.New("session not found")
+	}
 
 	return nil
 }
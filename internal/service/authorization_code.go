@@ -0,0 +1,146 @@
+package service
+
+import (
+	"time"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+type AuthorizationCodeRepository interface {
+	Save(ctx context.Context, code *entity.AuthorizationCode) error
+
+	// Атомарно извлекает и удаляет код
+	Consume(ctx context.Context, hash string) (*entity.AuthorizationCode, error)
+}
+
+// Выдача и погашение кодов авторизации (RFC 6749, 4.1)
+type AuthorizationCodes struct {
+	repo AuthorizationCodeRepository
+
+	expire time.Duration // срок жизни кода (сек.)
+	codeLen int // длина кода в байтах
+
+	logger log.Logger
+}
+
+func NewAuthorizationCodes(
+	repo AuthorizationCodeRepository,
+	expire time.Duration,
+	logger log.Logger,
+) *AuthorizationCodes {
+	return &AuthorizationCodes{
+		repo: repo,
+		expire: expire,
+		codeLen: 32,
+		logger: logger.WithFields(map[string]any{
+			"unit": "authorization_codes",
+		}),
+	}
+}
+
+// Сохраняет хеш нового кода и возвращает сам код
+func (a *AuthorizationCodes) Issue(
+	ctx context.Context,
+	code *entity.AuthorizationCode,
+) (string, error) {
+
+	b := make([]byte, a.codeLen)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Internal.New("read from rand").Wrap(err)
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(b)
+
+	stored := *code
+	stored.Hash = lookupHash(value)
+	stored.ExpireAt = time.Now().Add(time.Second * a.expire)
+
+	if err := a.repo.Save(ctx, &stored); err != nil {
+		return "", err
+	}
+
+	return value, nil
+}
+
+// Погашает код: код одноразовый, поэтому удаляется при любой попытке
+// обмена. Проверяются срок, клиент, redirect_uri и code_verifier.
+// redirectUri - значение из запроса обмена: если при авторизации
+// redirect_uri был указан, он обязателен и должен совпадать,
+// иначе его можно не указывать
+func (a *AuthorizationCodes) Redeem(
+	ctx context.Context,
+	value string,
+	clientId string,
+	redirectUri string,
+	codeVerifier string,
+) (*entity.AuthorizationCode, error) {
+
+	logger := a.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"client_id": clientId,
+	})
+
+	code, err := a.repo.Consume(ctx, lookupHash(value))
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			logger.Warn("unknown or used authorization code")
+
+			return nil, errors.InvalidGrant.New("invalid authorization code")
+		}
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	// Документ удаляется по TTL индексу с задержкой
+	if !time.Now().Before(code.ExpireAt) {
+		return nil, errors.InvalidGrant.New("authorization code expired")
+	}
+
+	if code.ClientId != clientId {
+		logger.Warn("authorization code issued to another client")
+
+		return nil, errors.InvalidGrant.New("invalid authorization code")
+	}
+
+	if code.RedirectUriExplicit && redirectUri == "" {
+		return nil, errors.InvalidGrant.New("redirect_uri is required")
+	}
+
+	if redirectUri != "" && redirectUri != code.RedirectUri {
+		return nil, errors.InvalidGrant.New("redirect_uri mismatch")
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, codeVerifier) {
+		logger.Warn("invalid code verifier")
+
+		return nil, errors.InvalidGrant.New("invalid code_verifier")
+	}
+
+	return code, nil
+}
+
+// Проверяет code_verifier по методу S256 (RFC 7636, 4.6)
+func verifyCodeChallenge(challenge, verifier string) bool {
+
+	// Длина code_verifier - от 43 до 128 символов (RFC 7636, 4.1)
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
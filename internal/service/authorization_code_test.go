@@ -0,0 +1,99 @@
+package service
+
+import (
+	"sync"
+	"context"
+	"testing"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+type codeRepo struct {
+	mu		sync.Mutex
+	codes	map[string]*entity.AuthorizationCode
+}
+
+func (r *codeRepo) Save(_ context.Context, code *entity.AuthorizationCode) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codes[code.Hash] = code
+
+	return nil
+}
+
+func (r *codeRepo) Consume(
+	_ context.Context,
+	hash string,
+) (*entity.AuthorizationCode, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	code, ok := r.codes[hash]
+	if !ok {
+		return nil, errors.NotFound.New("code not found")
+	}
+
+	delete(r.codes, hash)
+
+	return code, nil
+}
+
+// redirect_uri, указанный при авторизации, обязателен при обмене
+// и должен совпадать; неуказанный можно не передавать (RFC 6749, 4.1.3)
+func TestRedeemRedirectUri(t *testing.T) {
+
+	const (
+		registered	= "https://app.example.com/callback"
+		verifier	= "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge	= "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	cases := []struct {
+		name		string
+		explicit	bool
+		redeemWith	string
+		wantErr		bool
+	}{
+		{"explicit, same", true, registered, false},
+		{"explicit, omitted", true, "", true},
+		{"explicit, different", true, registered + "/other", true},
+		{"implicit, omitted", false, "", false},
+		{"implicit, same", false, registered, false},
+		{"implicit, different", false, registered + "/other", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			ctx := context.Background()
+
+			codes := NewAuthorizationCodes(
+				&codeRepo{codes: map[string]*entity.AuthorizationCode{}},
+				60,
+				log.NewLogrusLogger(),
+			)
+
+			value, err := codes.Issue(ctx, &entity.AuthorizationCode{
+				ClientId: "web-app",
+				RedirectUri: registered,
+				RedirectUriExplicit: c.explicit,
+				Uuid: "user-1",
+				CodeChallenge: challenge,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = codes.Redeem(ctx, value, "web-app", c.redeemWith, verifier)
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, want error %v", err, c.wantErr)
+			}
+		})
+	}
+}
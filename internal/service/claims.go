@@ -0,0 +1,120 @@
+package service
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Зарегистрированные утверждения (RFC 7519) access токенов
+type ClaimsPolicy struct {
+	Issuer		string		// iss, пустой - не проверяется
+	Audience	[]string	// aud, первая аудитория проверяется при разборе
+
+	// Допустимое расхождение часов при проверке exp, nbf и iat
+	Leeway		time.Duration
+}
+
+// Утверждения нового access токена
+func (j *Jwt) registeredClaims(
+	uuid string,
+	client *entity.Client,
+) *jwt.RegisteredClaims {
+
+	now := time.Now()
+
+	claims := &jwt.RegisteredClaims{
+		Subject: uuid,
+		ExpiresAt: j.expiresAt(j.accessExpireFor(client)),
+		IssuedAt: jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ID: newId(),
+	}
+
+	if j.claims.Issuer != "" {
+		claims.Issuer = j.claims.Issuer
+	}
+
+	if audience := j.audienceFor(client); len(audience) > 0 {
+		claims.Audience = jwt.ClaimStrings(audience)
+	}
+
+	return claims
+}
+
+// Параметры проверки утверждений при разборе токена
+func (j *Jwt) parserOptions(strict bool) []jwt.ParserOption {
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(j.validMethods()),
+		jwt.WithLeeway(time.Second * j.claims.Leeway),
+		jwt.WithIssuedAt(),
+	}
+
+	if !strict {
+		return options
+	}
+
+	if j.claims.Issuer != "" {
+		options = append(options, jwt.WithIssuer(j.claims.Issuer))
+	}
+
+	return options
+}
+
+// Проверяет, что токен предназначен самому сервису: среди aud есть
+// первая аудитория из конфигурации. Аудитория проверяется отдельно от
+// разбора, потому что интроспекция и обмен принимают токены любых
+// аудиторий. Токены без iss и aud выданы до их появления
+func (j *Jwt) checkAudience(claims *AccessClaims) error {
+
+	if len(j.claims.Audience) == 0 ||
+		(claims.Issuer == "" && len(claims.Audience) == 0) {
+		return nil
+	}
+
+	if !containsScope(claims.Audience, j.claims.Audience[0]) {
+		return errors.InvalidToken.New("invalid audience")
+	}
+
+	return nil
+}
+
+// Токены, выданные до появления зарегистрированных утверждений,
+// не содержат sub, iss и aud.
+// TODO: убрать поддержку в следующем релизе вместе с утверждением uuid
+func isLegacyClaims(claims jwt.Claims) bool {
+
+	sub, _ := claims.GetSubject()
+	iss, _ := claims.GetIssuer()
+	aud, _ := claims.GetAudience()
+
+	return sub == "" && iss == "" && len(aud) == 0
+}
+
+// Ошибки проверки утверждений объединяются, поэтому истекший токен
+// пригоден для обновления пары, только если других ошибок нет
+func isOnlyExpired(err error) bool {
+
+	if !errutil.Is(err, jwt.ErrTokenExpired) {
+		return false
+	}
+
+	for _, e := range []error{
+		jwt.ErrTokenNotValidYet,
+		jwt.ErrTokenUsedBeforeIssued,
+		jwt.ErrTokenInvalidIssuer,
+		jwt.ErrTokenInvalidAudience,
+	} {
+		if errutil.Is(err, e) {
+			return false
+		}
+	}
+
+	return true
+}
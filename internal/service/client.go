@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Хеш, с которым сравнивается секрет неизвестного клиента, чтобы время
+// ответа не выдавало, зарегистрирован ли клиент
+var dummySecretHash, _ = bcrypt.GenerateFromPassword(
+	[]byte("dummy secret"),
+	bcrypt.DefaultCost,
+)
+
+type ClientRepository interface {
+	GetById(ctx context.Context, id string) (*entity.Client, error)
+}
+
+type Clients struct {
+	repo ClientRepository
+
+	logger log.Logger
+}
+
+func NewClients(repo ClientRepository, logger log.Logger) *Clients {
+	return &Clients{
+		repo: repo,
+		logger: logger.WithFields(map[string]any{
+			"unit": "clients",
+		}),
+	}
+}
+
+// Проверяет идентификатор и секрет клиента
+func (c *Clients) Authenticate(
+	ctx context.Context,
+	id string,
+	secret string,
+) (*entity.Client, error) {
+
+	logger := c.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"client_id": id,
+	})
+
+	client, err := c.repo.GetById(ctx, id)
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			logger.Warn("unknown client")
+
+			bcrypt.CompareHashAndPassword(dummySecretHash, []byte(secret))
+
+			return nil, errors.Unauthorized.NewDefault().Wrap(err)
+		}
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	err = bcrypt.CompareHashAndPassword(
+		[]byte(client.SecretHash),
+		[]byte(secret),
+	)
+
+	if err != nil {
+		logger.Warn("invalid client secret")
+
+		return nil, errors.Unauthorized.NewDefault().Wrap(err)
+	}
+
+	return client, nil
+}
+
+// Возвращает клиента без проверки секрета (например, для /authorize)
+func (c *Clients) Get(ctx context.Context, id string) (*entity.Client, error) {
+
+	client, err := c.repo.GetById(ctx, id)
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return nil, errors.NotFound.New("client not found").Wrap(err)
+		}
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return client, nil
+}
+
+// Определяет публичного клиента, у которого нет секрета.
+// Конфиденциальные клиенты должны предъявлять секрет
+func (c *Clients) AuthenticatePublic(
+	ctx context.Context,
+	id string,
+) (*entity.Client, error) {
+
+	client, err := c.Get(ctx, id)
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return nil, errors.Unauthorized.NewDefault().Wrap(err)
+		}
+
+		return nil, err
+	}
+
+	if !client.Public {
+
+		c.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"client_id": id,
+		}).Warn("missing secret of confidential client")
+
+		return nil, errors.Unauthorized.New("client secret required")
+	}
+
+	return client, nil
+}
+
+// Аутентифицирует клиента по сертификату mTLS (tls_client_auth, RFC 8705).
+// Цепочка сертификата уже проверена TLS сервером по CA из конфигурации
+func (c *Clients) AuthenticateCertificate(
+	ctx context.Context,
+	id string,
+	cert *dto.ClientCertificate,
+) (*entity.Client, error) {
+
+	client, err := c.Get(ctx, id)
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return nil, errors.Unauthorized.NewDefault().Wrap(err)
+		}
+
+		return nil, err
+	}
+
+	if !client.AllowsCertificate(cert.SubjectDn, cert.DnsNames) {
+
+		c.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"client_id": id,
+			"subject_dn": cert.SubjectDn,
+		}).Warn("client certificate does not match")
+
+		return nil, errors.Unauthorized.New("client certificate does not match")
+	}
+
+	return client, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+)
+
+// Выдает access токен клиенту от его собственного имени
+// (client credentials, RFC 6749, 4.4). Refresh токен не выдается,
+// sub токена - идентификатор клиента. Токен, запрошенный по mTLS,
+// привязывается к сертификату клиента
+func (j *Jwt) ClientCredentialsToken(
+	ctx context.Context,
+	client *entity.Client,
+	scope string,
+	cnf *dto.Confirmation,
+) (*dto.TokenResponse, error) {
+
+	scopes := client.Scopes
+
+	if requested := parseScope(scope); len(requested) > 0 {
+
+		for _, s := range requested {
+			if !containsScope(client.Scopes, s) {
+				return nil, errors.InvalidScope.New("scope not allowed: " + s)
+			}
+		}
+
+		scopes = requested
+	}
+
+	session := &entity.RefreshToken{
+		Uuid: client.Id,
+		ClientId: client.Id,
+		Scopes: scopes,
+	}
+
+	session.Jkt, session.X5t = binding(cnf)
+
+	access, err := j.createAccess(
+		ctx,
+		session,
+		client,
+		nil,
+		"",
+		&entity.UserClaims{},
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.TokenResponse{
+		AccessToken: access,
+		TokenType: "Bearer",
+		ExpiresIn: j.expiresIn(client),
+		Scope: formatScope(scopes),
+	}, nil
+}
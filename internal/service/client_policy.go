@@ -0,0 +1,78 @@
+package service
+
+import (
+	"time"
+
+	"github.com/amaretur/auth-service/internal/entity"
+)
+
+// Параметры токенов определяются клиентом, которому они выдаются.
+// Без клиента (nil) используются значения из конфигурации
+
+func clientId(client *entity.Client) string {
+
+	if client == nil {
+		return ""
+	}
+
+	return client.Id
+}
+
+func (j *Jwt) accessExpireFor(client *entity.Client) time.Duration {
+
+	if client == nil || client.AccessExpire <= 0 {
+		return j.accessExpire
+	}
+
+	return client.AccessExpire
+}
+
+func (j *Jwt) refreshExpireFor(client *entity.Client) time.Duration {
+
+	if client == nil || client.RefreshExpire <= 0 {
+		return j.refreshExpire
+	}
+
+	return client.RefreshExpire
+}
+
+// Срок жизни access токена клиента в секундах (для ответа клиенту)
+func (j *Jwt) expiresIn(client *entity.Client) int64 {
+
+	expire := time.Minute * j.accessExpireFor(client)
+
+	return int64(expire.Seconds())
+}
+
+// Аудитории токена клиента. Первая аудитория из конфигурации
+// сохраняется, иначе сервис не примет собственный токен
+func (j *Jwt) audienceFor(client *entity.Client) []string {
+
+	if client == nil || len(client.Audience) == 0 {
+		return j.claims.Audience
+	}
+
+	var audience []string
+
+	if len(j.claims.Audience) > 0 {
+		audience = append(audience, j.claims.Audience[0])
+	}
+
+	for _, aud := range client.Audience {
+		if !containsScope(audience, aud) {
+			audience = append(audience, aud)
+		}
+	}
+
+	return audience
+}
+
+// Области доступа, доступные через клиента
+func clientScopes(client *entity.Client, scopes []string) []string {
+
+	if client == nil {
+		return scopes
+	}
+
+	return intersectScopes(scopes, client.Scopes)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+)
+
+// Подтверждение ключа для токенов сессии, привязанной к DPoP ключу
+// или сертификату mTLS
+func confirmation(session *entity.RefreshToken) *dto.Confirmation {
+
+	if session.Jkt == "" && session.X5t == "" {
+		return nil
+	}
+
+	return &dto.Confirmation{Jkt: session.Jkt, X5tS256: session.X5t}
+}
+
+// Отпечатки ключа и сертификата, к которым привязывается сессия
+func binding(cnf *dto.Confirmation) (string, string) {
+
+	if cnf == nil {
+		return "", ""
+	}
+
+	return cnf.Jkt, cnf.X5tS256
+}
+
+// Тип токенов сессии: пустой для обычных (Bearer) токенов
+func tokenType(session *entity.RefreshToken) string {
+
+	if session.Jkt == "" {
+		return ""
+	}
+
+	return TokenTypeDPoP
+}
+
+// Токен, привязанный к ключу, принимается только вместе с подтверждением
+// владения этим ключом: DPoP доказательством (RFC 9449, 7) или тем же
+// сертификатом mTLS (RFC 8705, 3). presented - подтвержденные клиентом
+// ключи (nil - токен предъявлен без подтверждений)
+func checkConfirmation(claims *AccessClaims, presented *dto.Confirmation) error {
+
+	if claims.Cnf == nil {
+		return nil
+	}
+
+	if presented == nil {
+		presented = &dto.Confirmation{}
+	}
+
+	if claims.Cnf.Jkt != "" && claims.Cnf.Jkt != presented.Jkt {
+		return errors.InvalidToken.New("dpop proof does not match token")
+	}
+
+	if claims.Cnf.X5tS256 != "" && claims.Cnf.X5tS256 != presented.X5tS256 {
+		return errors.InvalidToken.New("client certificate does not match token")
+	}
+
+	return nil
+}
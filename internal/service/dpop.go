@@ -0,0 +1,235 @@
+package service
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"strings"
+	"net/url"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/base64"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Тип токенов, привязанных к DPoP ключу (RFC 9449, 5)
+const TokenTypeDPoP = "DPoP"
+
+// Асимметричные алгоритмы подписи DPoP доказательства
+var dpopMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Хранилище использованных jti DPoP доказательств
+type DPoPReplayCache interface {
+	// Запоминает jti до expireAt. Возвращает false, если jti уже использован
+	Use(ctx context.Context, jti string, expireAt time.Time) (bool, error)
+}
+
+// Утверждения DPoP доказательства (RFC 9449, 4.2)
+type DPoPClaims struct {
+	*jwt.RegisteredClaims
+
+	Htm	string	`json:"htm"`
+	Htu	string	`json:"htu"`
+	Ath	string	`json:"ath,omitempty"`
+}
+
+// Проверка DPoP доказательств (RFC 9449, 4.3)
+type DPoP struct {
+	replay DPoPReplayCache
+
+	// Схема и хост внешнего адреса сервиса: htu сверяется с ними,
+	// а не с заголовками запроса, которые может подменить клиент
+	origin string
+
+	maxAge time.Duration // срок действия доказательства с момента iat (сек.)
+	leeway time.Duration // допустимое расхождение часов (сек.)
+
+	logger log.Logger
+}
+
+func NewDPoP(
+	replay DPoPReplayCache,
+	baseUrl string,
+	maxAge time.Duration,
+	leeway time.Duration,
+	logger log.Logger,
+) *DPoP {
+	return &DPoP{
+		replay: replay,
+		origin: origin(baseUrl),
+		maxAge: maxAge,
+		leeway: leeway,
+		logger: logger.WithFields(map[string]any{
+			"unit": "dpop",
+		}),
+	}
+}
+
+// Проверяет доказательство и возвращает отпечаток (RFC 7638)
+// публичного ключа, которым оно подписано
+func (d *DPoP) Verify(ctx context.Context, proof *dto.DPoPProof) (string, error) {
+
+	var jwk *dto.Jwk
+
+	claims := &DPoPClaims{RegisteredClaims: &jwt.RegisteredClaims{}}
+
+	_, err := jwt.ParseWithClaims(
+		proof.Proof,
+		claims,
+		func(token *jwt.Token) (any, error) {
+
+			if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+				return nil, fmt.Errorf("invalid typ")
+			}
+
+			var err error
+
+			jwk, err = headerJwk(token.Header["jwk"])
+			if err != nil {
+				return nil, err
+			}
+
+			return jwkPublicKey(jwk)
+		},
+		jwt.WithValidMethods(dpopMethods),
+	)
+
+	if err != nil {
+		return "", d.invalid(ctx, err.Error())
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return "", d.invalid(ctx, "missing jti or iat")
+	}
+
+	if !strings.EqualFold(claims.Htm, proof.Method) {
+		return "", d.invalid(ctx, "htm does not match request method")
+	}
+
+	if d.origin == "" {
+		return "", d.invalid(ctx, "external url is not configured")
+	}
+
+	if !sameUrl(claims.Htu, d.origin + proof.Path) {
+		return "", d.invalid(ctx, "htu does not match request url")
+	}
+
+	// Доказательство для предъявления access токена (RFC 9449, 7)
+	if proof.AccessToken != "" && claims.Ath != accessTokenHash(proof.AccessToken) {
+		return "", d.invalid(ctx, "ath does not match access token")
+	}
+
+	now := time.Now()
+	iat := claims.IssuedAt.Time
+
+	if iat.After(now.Add(time.Second * d.leeway)) ||
+		now.After(iat.Add(time.Second * (d.maxAge + d.leeway))) {
+
+		return "", d.invalid(ctx, "iat is out of acceptable window")
+	}
+
+	jkt, err := thumbprint(jwk)
+	if err != nil {
+		return "", d.invalid(ctx, err.Error())
+	}
+
+	// jti уникален в пределах ключа
+	fresh, err := d.replay.Use(
+		ctx,
+		lookupHash(jkt + "." + claims.ID),
+		iat.Add(time.Second * (d.maxAge + d.leeway)),
+	)
+	if err != nil {
+		return "", errors.Internal.NewDefault().Wrap(err)
+	}
+
+	if !fresh {
+		return "", d.invalid(ctx, "proof replayed")
+	}
+
+	return jkt, nil
+}
+
+func (d *DPoP) invalid(ctx context.Context, reason string) error {
+
+	d.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+	}).Warnf("invalid dpop proof: %s", reason)
+
+	return errors.InvalidDPoPProof.New(reason)
+}
+
+// Публичный ключ из заголовка jwk. Приватная часть ключа недопустима
+func headerJwk(value any) (*dto.Jwk, error) {
+
+	members, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("missing jwk header")
+	}
+
+	if _, ok := members["d"]; ok {
+		return nil, fmt.Errorf("jwk header contains private key")
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwk dto.Jwk
+
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("invalid jwk header")
+	}
+
+	return &jwk, nil
+}
+
+// Схема и хост адреса (пустая строка для относительного адреса)
+func origin(address string) string {
+
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+// BASE64URL(SHA256(access токен)) для утверждения ath (RFC 9449, 4.2)
+func accessTokenHash(access string) string {
+
+	sum := sha256.Sum256([]byte(access))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Сравнивает адреса без учета параметров запроса и фрагмента (RFC 9449, 4.3)
+func sameUrl(a, b string) bool {
+
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(ua.Scheme, ub.Scheme) &&
+		strings.EqualFold(ua.Host, ub.Host) &&
+		ua.Path == ub.Path
+}
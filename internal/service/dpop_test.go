@@ -0,0 +1,208 @@
+package service
+
+import (
+	"time"
+	"context"
+	"testing"
+	"crypto/rand"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/repository"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Ключ клиента, которым подписываются DPoP доказательства
+type dpopKey struct {
+	private	*ecdsa.PrivateKey
+	jkt		string
+}
+
+func newDPoPKey(t *testing.T) *dpopKey {
+
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jkt, err := thumbprint(publicJwk(&private.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &dpopKey{private: private, jkt: jkt}
+}
+
+// Доказательство для запроса method htu; access - предъявляемый
+// вместе с ним токен (пустой - без ath)
+func (k *dpopKey) proof(t *testing.T, method, htu, access string) string {
+
+	t.Helper()
+
+	claims := &DPoPClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			ID: newId(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Htm: method,
+		Htu: htu,
+	}
+
+	if access != "" {
+		claims.Ath = accessTokenHash(access)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = publicJwk(&k.private.PublicKey)
+
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func newTestDPoP() *DPoP {
+	return NewDPoP(
+		repository.NewDPoPReplayMemory(),
+		"https://auth.example.com/api/v1",
+		60,
+		30,
+		log.NewLogrusLogger(),
+	)
+}
+
+// htu сверяется с внешним адресом из конфигурации, а не с адресом,
+// который клиент может передать в заголовках запроса
+func TestDPoPHtuFromBaseUrl(t *testing.T) {
+
+	ctx := context.Background()
+	dpop := newTestDPoP()
+	key := newDPoPKey(t)
+
+	cases := []struct {
+		name	string
+		htu		string
+		wantErr	bool
+	}{
+		{"configured origin", "https://auth.example.com/api/v1/sign-in", false},
+		{"query ignored", "https://auth.example.com/api/v1/sign-in?x=1", false},
+		{"foreign host", "https://evil.example.com/api/v1/sign-in", true},
+		{"foreign scheme", "http://auth.example.com/api/v1/sign-in", true},
+		{"foreign path", "https://auth.example.com/api/v1/refresh", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			jkt, err := dpop.Verify(ctx, &dto.DPoPProof{
+				Proof: key.proof(t, "POST", c.htu, ""),
+				Method: "POST",
+				Path: "/api/v1/sign-in",
+			})
+
+			if (err != nil) != c.wantErr {
+				t.Fatalf("err = %v, want error %v", err, c.wantErr)
+			}
+
+			if err == nil && jkt != key.jkt {
+				t.Fatalf("jkt = %q, want %q", jkt, key.jkt)
+			}
+		})
+	}
+}
+
+// Привязанный к ключу токен принимается только вместе с подтверждением
+// владения ключом: DPoP доказательством с ath этого токена или тем же
+// сертификатом mTLS
+func TestVerifyAccessRequiresConfirmation(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+	dpop := newTestDPoP()
+	key := newDPoPKey(t)
+
+	const htu = "https://auth.example.com/api/v1/sessions"
+
+	bound, err := j.CreateTokens(
+		ctx,
+		"user-1",
+		&dto.SessionMeta{},
+		"",
+		testClient,
+		&dto.Confirmation{Jkt: key.jkt},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.VerifyAccess(ctx, bound.Access, nil); err == nil {
+		t.Fatal("dpop-bound token accepted as bearer")
+	}
+
+	// Доказательство без ath или для другого токена не подходит
+	for _, access := range []string{"", "other-token"} {
+
+		_, err := dpop.Verify(ctx, &dto.DPoPProof{
+			Proof: key.proof(t, "GET", htu, access),
+			Method: "GET",
+			Path: "/api/v1/sessions",
+			AccessToken: bound.Access,
+		})
+		if err == nil {
+			t.Fatalf("proof with ath of %q accepted", access)
+		}
+	}
+
+	jkt, err := dpop.Verify(ctx, &dto.DPoPProof{
+		Proof: key.proof(t, "GET", htu, bound.Access),
+		Method: "GET",
+		Path: "/api/v1/sessions",
+		AccessToken: bound.Access,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.VerifyAccess(ctx, bound.Access, &dto.Confirmation{Jkt: jkt}); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newDPoPKey(t)
+
+	if _, err := j.VerifyAccess(ctx, bound.Access, &dto.Confirmation{Jkt: other.jkt}); err == nil {
+		t.Fatal("dpop-bound token accepted with another key")
+	}
+
+	// Токен, привязанный к сертификату mTLS
+	certBound, err := j.CreateTokens(
+		ctx,
+		"user-1",
+		&dto.SessionMeta{},
+		"",
+		testClient,
+		&dto.Confirmation{X5tS256: "cert-thumbprint"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, presented := range []*dto.Confirmation{nil, {X5tS256: "other-cert"}} {
+		if _, err := j.VerifyAccess(ctx, certBound.Access, presented); err == nil {
+			t.Fatalf("certificate-bound token accepted with %+v", presented)
+		}
+	}
+
+	_, err = j.VerifyAccess(ctx, certBound.Access, &dto.Confirmation{X5tS256: "cert-thumbprint"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Дополняет access токен произвольными утверждениями
+// (например, tenant_id, тариф, флаги функций)
+type ClaimsEnricher interface {
+	Enrich(
+		ctx context.Context,
+		request *entity.EnrichRequest,
+	) (map[string]any, error)
+}
+
+// Утверждения, которые выставляет сам сервис.
+// Дополнительные утверждения не могут их переопределить
+var reservedClaims = map[string]bool{
+	"iss": true,
+	"sub": true,
+	"aud": true,
+	"exp": true,
+	"nbf": true,
+	"iat": true,
+	"jti": true,
+	"uuid": true,
+	"r_id": true,
+	"client_id": true,
+	"act": true,
+	"cnf": true,
+	"scope": true,
+	"roles": true,
+	"permissions": true,
+}
+
+// Запрашивает дополнительные утверждения для access токена сессии
+func (j *Jwt) extraClaims(
+	ctx context.Context,
+	session *entity.RefreshToken,
+) (map[string]any, error) {
+
+	if j.enricher == nil {
+		return nil, nil
+	}
+
+	logger := j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"uuid": session.Uuid,
+	})
+
+	claims, err := j.enricher.Enrich(ctx, &entity.EnrichRequest{
+		Uuid: session.Uuid,
+		ClientId: session.ClientId,
+		Scopes: session.Scopes,
+	})
+	if err != nil {
+		logger.Errorf("enrich claims: %s", err)
+
+		return nil, errors.Internal.New("enrich claims").Wrap(err)
+	}
+
+	for name := range claims {
+		if reservedClaims[name] {
+			logger.Warnf("enricher tried to override reserved claim %s", name)
+
+			delete(claims, name)
+		}
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"time"
+	"context"
+	"testing"
+	"net/http"
+	"encoding/json"
+	"net/http/httptest"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/repository"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Ответ вебхука: tenant_id и попытка переопределить зарегистрированные утверждения
+func webhookClaims(w http.ResponseWriter, r *http.Request) {
+
+	var request struct {
+		Sub			string		`json:"sub"`
+		ClientId	string		`json:"client_id"`
+		Scopes		[]string	`json:"scopes"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil ||
+		request.Sub != "user-1" || request.ClientId != "web-app" ||
+		len(request.Scopes) != 2 {
+
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"tenant_id": "tenant-1",
+		"sub": "admin",
+		"roles": []string{"admin"},
+		"scope": "admin",
+	})
+}
+
+func TestClaimsWebhook(t *testing.T) {
+
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	cases := []struct {
+		name		string
+		handler		http.HandlerFunc // nil - вебхук не отвечает до конца теста
+		fallback	string
+		wantErr		bool
+		wantTenant	bool
+	}{
+		{"success", webhookClaims, repository.WebhookFallbackFail, false, true},
+		{"timeout fail", nil, repository.WebhookFallbackFail, true, false},
+		{"timeout skip", nil, repository.WebhookFallbackSkip, false, false},
+		{"non-2xx fail", failing, repository.WebhookFallbackFail, true, false},
+		{"non-2xx skip", failing, repository.WebhookFallbackSkip, false, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			release := make(chan struct{})
+
+			handler := c.handler
+			if handler == nil {
+				handler = func(http.ResponseWriter, *http.Request) {
+					<-release
+				}
+			}
+
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			defer close(release)
+
+			j := newTestJwt(t, nil)
+			j.enricher = repository.NewClaimsWebhook(
+				server.URL,
+				100 * time.Millisecond,
+				c.fallback,
+				log.NewLogrusLogger(),
+			)
+
+			tokens, err := j.CreateTokens(
+				context.Background(),
+				"user-1",
+				&dto.SessionMeta{},
+				"",
+				testClient,
+				nil,
+			)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("token issued despite webhook failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims := jwt.MapClaims{}
+
+			_, _, err = jwt.NewParser().ParseUnverified(tokens.Access, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := claims["tenant_id"]; ok != c.wantTenant {
+				t.Fatalf("tenant_id present = %v, want %v", ok, c.wantTenant)
+			}
+
+			// Зарегистрированные утверждения остаются выставленными сервисом
+			if claims["sub"] != "user-1" || claims["scope"] != "read write" {
+				t.Fatalf("reserved claims overridden: %v", claims)
+			}
+
+			roles, _ := claims["roles"].([]any)
+			if len(roles) != 1 || roles[0] != "user" {
+				t.Fatalf("roles = %v, want [user]", claims["roles"])
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"sync"
+	"time"
+	"context"
+	"strconv"
+	"testing"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/pem"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Хранилище refresh токенов в памяти. Consume атомарен, как в MongoDB
+type tokenRepo struct {
+	mu		sync.Mutex
+	tokens	map[string]*entity.RefreshToken
+	seq		int
+
+	// Вызывается перед сохранением токена (для проверки гонок)
+	onSave	func()
+}
+
+func newTokenRepo() *tokenRepo {
+	return &tokenRepo{tokens: map[string]*entity.RefreshToken{}}
+}
+
+func (r *tokenRepo) Save(
+	_ context.Context,
+	token *entity.RefreshToken,
+) (string, error) {
+
+	if r.onSave != nil {
+		r.onSave()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+
+	saved := *token
+	saved.Id = strconv.Itoa(r.seq)
+
+	r.tokens[saved.Id] = &saved
+
+	return saved.Id, nil
+}
+
+func (r *tokenRepo) GetById(
+	_ context.Context,
+	id string,
+) (*entity.RefreshToken, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil, errors.NotFound.New("token not found")
+	}
+
+	found := *token
+
+	return &found, nil
+}
+
+func (r *tokenRepo) GetByLookup(
+	_ context.Context,
+	lookup string,
+) (*entity.RefreshToken, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		if token.Lookup == lookup {
+			found := *token
+			return &found, nil
+		}
+	}
+
+	return nil, errors.NotFound.New("token not found")
+}
+
+func (r *tokenRepo) Delete(_ context.Context, id string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.tokens, id)
+
+	return nil
+}
+
+func (r *tokenRepo) Consume(_ context.Context, id string, hash string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.Rotated || token.Token != hash {
+		return errors.NotFound.New("token not found")
+	}
+
+	token.Rotated = true
+
+	return nil
+}
+
+func (r *tokenRepo) DeleteFamily(_ context.Context, familyId string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.FamilyId == familyId {
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *tokenRepo) DeleteByUuid(_ context.Context, uuid string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.Uuid == uuid {
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (r *tokenRepo) GetActiveByUuid(
+	_ context.Context,
+	uuid string,
+	_ time.Time,
+) ([]*entity.RefreshToken, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var active []*entity.RefreshToken
+
+	for _, token := range r.tokens {
+		if token.Uuid == uuid && !token.Rotated && time.Now().Before(token.ExpireAt) {
+			found := *token
+			active = append(active, &found)
+		}
+	}
+
+	return active, nil
+}
+
+func (r *tokenRepo) DeleteUserFamily(
+	_ context.Context,
+	uuid, familyId string,
+) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.Uuid == uuid && token.FamilyId == familyId {
+			delete(r.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+// Семейство единственной сессии в хранилище
+func (r *tokenRepo) familyId() string {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, token := range r.tokens {
+		return token.FamilyId
+	}
+
+	return ""
+}
+
+// Размер семейства (число документов, включая использованные)
+func (r *tokenRepo) family(familyId string) int {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+
+	for _, token := range r.tokens {
+		if token.FamilyId == familyId {
+			count++
+		}
+	}
+
+	return count
+}
+
+type notBeforeRepo struct {
+	mu		sync.Mutex
+	values	map[string]time.Time
+}
+
+func (r *notBeforeRepo) Set(
+	_ context.Context,
+	uuid string,
+	notBefore time.Time,
+	_ time.Duration,
+) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.values[uuid] = notBefore
+
+	return nil
+}
+
+func (r *notBeforeRepo) Get(_ context.Context, uuid string) (time.Time, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.values[uuid], nil
+}
+
+type denylist struct {
+	mu		sync.Mutex
+	jti		map[string]bool
+}
+
+func (d *denylist) Add(_ context.Context, jti string, _ time.Time) error {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.jti[jti] = true
+
+	return nil
+}
+
+func (d *denylist) Contains(_ context.Context, jti string) (bool, error) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.jti[jti], nil
+}
+
+type opaqueRepo struct {
+	mu		sync.Mutex
+	tokens	map[string]*entity.OpaqueToken
+}
+
+func (r *opaqueRepo) Save(_ context.Context, token *entity.OpaqueToken) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens[token.Lookup] = token
+
+	return nil
+}
+
+func (r *opaqueRepo) GetByLookup(
+	_ context.Context,
+	lookup string,
+) (*entity.OpaqueToken, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[lookup]
+	if !ok {
+		return nil, errors.NotFound.New("token not found")
+	}
+
+	return token, nil
+}
+
+type noLocker struct{}
+
+func (noLocker) Lock(context.Context, string) (func(), error) {
+	return func() {}, nil
+}
+
+// Все пользователи получают одинаковые полномочия
+type staticClaims struct {
+	claims	*entity.UserClaims
+}
+
+func (s staticClaims) Claims(context.Context, string) (*entity.UserClaims, error) {
+	return s.claims, nil
+}
+
+type testJwt struct {
+	*Jwt
+
+	tokens		*tokenRepo
+	notBefore	*notBeforeRepo
+	keys		*KeyRing
+}
+
+var testClient = &entity.Client{
+	Id: "web-app",
+	GrantTypes: []string{entity.GrantSignIn, entity.GrantRefreshToken},
+	Scopes: []string{"read", "write"},
+}
+
+func newTestJwt(t *testing.T, key *Key) *testJwt {
+
+	t.Helper()
+
+	if key == nil {
+		key = newTestKey(t)
+	}
+
+	tokens := newTokenRepo()
+	notBefore := &notBeforeRepo{values: map[string]time.Time{}}
+	keys := NewKeyRing(key)
+
+	logger := log.NewLogrusLogger()
+
+	j := NewJwt(
+		tokens,
+		notBefore,
+		&denylist{jti: map[string]bool{}},
+		&opaqueRepo{tokens: map[string]*entity.OpaqueToken{}},
+		noLocker{},
+		staticClaims{&entity.UserClaims{
+			Roles: []string{"user"},
+			Scopes: []string{"read", "write"},
+		}},
+		nil,
+		15,
+		60,
+		AccessTokenJwt,
+		SessionPolicy{},
+		ClaimsPolicy{Issuer: "https://auth.example.com", Audience: []string{"auth-service"}},
+		keys,
+		logger,
+	)
+
+	return &testJwt{Jwt: j, tokens: tokens, notBefore: notBefore, keys: keys}
+}
+
+// ES256 ключ со сгенерированным приватным ключом
+func newTestKey(t *testing.T) *Key {
+
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewKey(
+		jwt.SigningMethodES256,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+// Проверяет, что в цепочке ошибок есть ошибка с указанным описанием
+func hasInfo(err error, info string) bool {
+
+	for err != nil {
+
+		if e, ok := err.(*errutil.Instance); ok && e.Info == info {
+			return true
+		}
+
+		err = errutil.Unwrap(err)
+	}
+
+	return false
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"time"
+	"context"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/reqid"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Значения token_type_hint (RFC 7009, RFC 7662)
+const (
+	AccessTokenHint		= "access_token"
+	RefreshTokenHint	= "refresh_token"
+)
+
+type introspector func(
+	ctx context.Context,
+	token string,
+) (*dto.Introspection, error)
+
+// Интроспекция токена (RFC 7662): определяет, действителен ли access
+// или refresh токен. Подсказка hint задает, какой тип проверить первым
+func (j *Jwt) Introspect(
+	ctx context.Context,
+	token string,
+	hint string,
+) (*dto.Introspection, error) {
+
+	introspectors := []introspector{j.introspectAccess, j.introspectRefresh}
+
+	if hint == RefreshTokenHint {
+		introspectors = []introspector{j.introspectRefresh, j.introspectAccess}
+	}
+
+	for _, introspect := range introspectors {
+
+		result, err := introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+
+		if result != nil {
+			return result, nil
+		}
+	}
+
+	return &dto.Introspection{Active: false}, nil
+}
+
+// Возвращает nil, если токен не является действительным access токеном
+func (j *Jwt) introspectAccess(
+	ctx context.Context,
+	token string,
+) (*dto.Introspection, error) {
+
+	claims, err := j.verifyIssued(ctx, token)
+	if err != nil {
+
+		if errutil.Has(err, errors.Internal) {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+
+	result := &dto.Introspection{
+		Active: true,
+		Sub: claims.Subject,
+		Iss: claims.Issuer,
+		Aud: claims.Audience,
+		Jti: claims.ID,
+		Scope: claims.Scope,
+		ClientId: claims.ClientId,
+		TokenType: "Bearer",
+		Cnf: claims.Cnf,
+		Roles: claims.Roles,
+		Permissions: claims.Permissions,
+		Extra: claims.Extra,
+	}
+
+	if claims.Cnf != nil && claims.Cnf.Jkt != "" {
+		result.TokenType = TokenTypeDPoP
+	}
+
+	if claims.ExpiresAt != nil {
+		result.Exp = claims.ExpiresAt.Unix()
+	}
+
+	if claims.IssuedAt != nil {
+		result.Iat = claims.IssuedAt.Unix()
+	}
+
+	if claims.NotBefore != nil {
+		result.Nbf = claims.NotBefore.Unix()
+	}
+
+	return result, nil
+}
+
+// Возвращает nil, если токен не является действительным refresh токеном
+func (j *Jwt) introspectRefresh(
+	ctx context.Context,
+	token string,
+) (*dto.Introspection, error) {
+
+	refresh, err := j.repo.GetByLookup(ctx, lookupHash(token))
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return nil, nil
+		}
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	if err := j.hashCompare(refresh.Token, token); err != nil {
+		return nil, nil
+	}
+
+	// Использованный токен уже не может быть обменян на новую пару.
+	// Документ удаляется по TTL индексу с задержкой
+	if refresh.Rotated || !time.Now().Before(refresh.ExpireAt) ||
+		j.checkSessionExpiry(ctx, refresh) != nil {
+		return nil, nil
+	}
+
+	return &dto.Introspection{
+		Active: true,
+		Sub: refresh.Uuid,
+		Exp: refresh.ExpireAt.Unix(),
+		Jti: refresh.Id,
+		Scope: formatScope(refresh.Scopes),
+		ClientId: refresh.ClientId,
+		TokenType: RefreshTokenHint,
+		Cnf: confirmation(refresh),
+	}, nil
+}
+
+type revoker func(
+	ctx context.Context,
+	client *entity.Client,
+	token string,
+) (bool, error)
+
+// Отзыв токена (RFC 7009). Неизвестный или уже недействительный токен
+// не считается ошибкой. Клиент может отозвать только выданный ему токен,
+// токен другого клиента не отзывается, но ошибка не возвращается
+// (RFC 7009, 2.1). Подсказка hint задает, какой тип проверить первым
+func (j *Jwt) Revoke(
+	ctx context.Context,
+	client *entity.Client,
+	token string,
+	hint string,
+) error {
+
+	revokers := []revoker{j.revokeAccess, j.revokeRefresh}
+
+	if hint == RefreshTokenHint {
+		revokers = []revoker{j.revokeRefresh, j.revokeAccess}
+	}
+
+	for _, revoke := range revokers {
+
+		revoked, err := revoke(ctx, client, token)
+		if err != nil {
+			return err
+		}
+
+		if revoked {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Добавляет access токен в список отозванных.
+// Возвращает false, если токен не является действительным access токеном
+func (j *Jwt) revokeAccess(
+	ctx context.Context,
+	client *entity.Client,
+	token string,
+) (bool, error) {
+
+	claims, err := j.verifyIssued(ctx, token)
+	if err != nil {
+
+		if errutil.Has(err, errors.Internal) {
+			return false, err
+		}
+
+		return false, nil
+	}
+
+	if !j.issuedTo(ctx, client, claims.ClientId) {
+		return true, nil
+	}
+
+	if err := j.denyAccess(ctx, claims); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Удаляет семейство refresh токена из БД: преемники отозванного токена
+// также недействительны. Возвращает false, если такого refresh токена нет
+func (j *Jwt) revokeRefresh(
+	ctx context.Context,
+	client *entity.Client,
+	token string,
+) (bool, error) {
+
+	refresh, err := j.repo.GetByLookup(ctx, lookupHash(token))
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return false, nil
+		}
+
+		return false, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	if err := j.hashCompare(refresh.Token, token); err != nil {
+		return false, nil
+	}
+
+	if !j.issuedTo(ctx, client, refresh.ClientId) {
+		return true, nil
+	}
+
+	if err := j.deleteSession(ctx, refresh); err != nil {
+		return false, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return true, nil
+}
+
+// Проверяет, что токен выдан клиенту, запросившему отзыв
+func (j *Jwt) issuedTo(
+	ctx context.Context,
+	client *entity.Client,
+	tokenClientId string,
+) bool {
+
+	if tokenClientId == clientId(client) {
+		return true
+	}
+
+	j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"client_id": clientId(client),
+	}).Warn("revocation of token issued to another client")
+
+	return false
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"encoding/json"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+)
+
+// Клиент не может отозвать токены, выданные другому клиенту
+func TestRevokeForeignToken(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &entity.Client{Id: "resource-server"}
+
+	for _, token := range []string{tokens.Access, tokens.Refresh} {
+		if err := j.Revoke(ctx, other, token, ""); err != nil {
+			t.Fatalf("revoke: %s", err)
+		}
+	}
+
+	if _, err := j.VerifyAccess(ctx, tokens.Access, nil); err != nil {
+		t.Fatalf("access token revoked by another client: %s", err)
+	}
+
+	if _, err := j.RefreshTokens(ctx, tokens, testClient, nil); err != nil {
+		t.Fatalf("refresh token revoked by another client: %s", err)
+	}
+}
+
+// Отзыв refresh токена удаляет его семейство вместе с преемниками
+func TestRevokeRefreshFamily(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	first, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	familyId := j.tokens.familyId()
+
+	second, err := j.RefreshTokens(ctx, first, testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := j.Revoke(ctx, testClient, first.Refresh, RefreshTokenHint); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := j.tokens.family(familyId); size != 0 {
+		t.Fatalf("family has %d tokens after revocation", size)
+	}
+
+	if _, err := j.RefreshTokens(ctx, second, testClient, nil); err == nil {
+		t.Fatal("successor of revoked token refreshed")
+	}
+}
+
+// Дополнительные утверждения для всех токенов
+type staticEnricher map[string]any
+
+func (e staticEnricher) Enrich(
+	context.Context,
+	*entity.EnrichRequest,
+) (map[string]any, error) {
+
+	claims := make(map[string]any, len(e))
+	for name, value := range e {
+		claims[name] = value
+	}
+
+	return claims, nil
+}
+
+// Дополнительные утверждения непрозрачного токена сохраняются вместе
+// с ним и возвращаются при разборе и интроспекции, в том числе после
+// обновления пары; отозванный токен неактивен
+func TestOpaqueExtraClaims(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	j.accessFormat = AccessTokenOpaque
+	j.enricher = staticEnricher{"tenant_id": "tenant-1"}
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isOpaque(tokens.Access) {
+		t.Fatalf("access token %q is not opaque", tokens.Access)
+	}
+
+	checkExtra := func(access string) {
+
+		t.Helper()
+
+		claims, err := j.VerifyAccess(ctx, access, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Extra["tenant_id"] != "tenant-1" {
+			t.Fatalf("extra = %v, want tenant_id", claims.Extra)
+		}
+
+		info, err := j.Introspect(ctx, access, AccessTokenHint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !info.Active || info.Extra["tenant_id"] != "tenant-1" {
+			t.Fatalf("introspection = %+v, want active with tenant_id", info)
+		}
+
+		data, err := json.Marshal(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var response map[string]any
+		if err := json.Unmarshal(data, &response); err != nil {
+			t.Fatal(err)
+		}
+
+		if response["tenant_id"] != "tenant-1" || response["sub"] != "user-1" {
+			t.Fatalf("introspection response = %s", data)
+		}
+	}
+
+	checkExtra(tokens.Access)
+
+	refreshed, err := j.RefreshTokens(ctx, tokens, testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkExtra(refreshed.Access)
+
+	if err := j.Revoke(ctx, testClient, refreshed.Access, AccessTokenHint); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := j.Introspect(ctx, refreshed.Access, AccessTokenHint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Active {
+		t.Fatal("revoked opaque token is active")
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"time"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"encoding/base64"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/google/uuid"
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
 	"github.com/amaretur/auth-service/internal/errors"
 
 	"github.com/amaretur/auth-service/pkg/log"
@@ -19,19 +24,140 @@ import (
 
 type AccessClaims struct {
 	*jwt.RegisteredClaims
-	Uuid		string	`json:"uuid"`
-	RefreshId	string	`json:"r_id"`
+
+	// Дублирует sub для сервисов, читающих прежнее утверждение.
+	// TODO: убрать в следующем релизе
+	Uuid		string	`json:"uuid,omitempty"`
+
+	RefreshId	string	`json:"r_id,omitempty"`
+
+	// Клиент, которому выдан токен (RFC 9068)
+	ClientId	string	`json:"client_id,omitempty"`
+
+	// Цепочка действующих сторон токена, полученного обменом (RFC 8693)
+	Act			*Actor	`json:"act,omitempty"`
+
+	// Ключ, к которому привязан токен (RFC 7800)
+	Cnf			*dto.Confirmation	`json:"cnf,omitempty"`
+
+	// Области доступа (через пробел) и полномочия пользователя
+	Scope		string		`json:"scope,omitempty"`
+	Roles		[]string	`json:"roles,omitempty"`
+	Permissions	[]string	`json:"permissions,omitempty"`
+
+	// Дополнительные утверждения от ClaimsEnricher
+	Extra		map[string]any	`json:"-"`
+}
+
+// Добавляет к утверждениям токена дополнительные,
+// не переопределяя уже заданные
+func (c *AccessClaims) MarshalJSON() ([]byte, error) {
+
+	type claims AccessClaims
+
+	data, err := json.Marshal((*claims)(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]any)
+
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+
+	for name, value := range c.Extra {
+		if _, ok := merged[name]; !ok {
+			merged[name] = value
+		}
+	}
+
+	return json.Marshal(merged)
+}
+
+// Утверждения, которые сервис не выставляет сам, сохраняются в Extra:
+// так они восстанавливаются из непрозрачного токена и попадают
+// в ответ интроспекции
+func (c *AccessClaims) UnmarshalJSON(data []byte) error {
+
+	type claims AccessClaims
+
+	if err := json.Unmarshal(data, (*claims)(c)); err != nil {
+		return err
+	}
+
+	all := make(map[string]any)
+
+	if err := json.Unmarshal(data, &all); err != nil {
+		return err
+	}
+
+	c.Extra = nil
+
+	for name, value := range all {
+		if reservedClaims[name] {
+			continue
+		}
+
+		if c.Extra == nil {
+			c.Extra = make(map[string]any)
+		}
+
+		c.Extra[name] = value
+	}
+
+	return nil
 }
 
 type TokenRepository interface {
-	Save(
+	Save(ctx context.Context, token *entity.RefreshToken) (string, error)
+
+	GetById(ctx context.Context, id string) (*entity.RefreshToken, error)
+	GetByLookup(
 		ctx context.Context,
-		token string,
-		expire time.Duration,
-	) (string, error)
+		lookup string,
+	) (*entity.RefreshToken, error)
 
-	GetById(ctx context.Context, id string) (string, error)
 	Delete(ctx context.Context, id string) error
+
+	// Атомарно помечает токен с указанным хешем как использованный
+	Consume(ctx context.Context, id string, token string) error
+
+	// Удаляет все токены семейства
+	DeleteFamily(ctx context.Context, familyId string) error
+
+	// Удаляет все токены пользователя
+	DeleteByUuid(ctx context.Context, uuid string) error
+
+	// Действующие токены пользователя (по одному на сессию), кроме
+	// сессий с истекшим абсолютным сроком и не обновлявшихся с idleSince
+	GetActiveByUuid(
+		ctx context.Context,
+		uuid string,
+		idleSince time.Time,
+	) ([]*entity.RefreshToken, error)
+
+	// Удаляет семейство токенов, если оно принадлежит пользователю
+	DeleteUserFamily(ctx context.Context, uuid, familyId string) error
+}
+
+// Список отозванных access токенов (по jti). Записи нужны
+// только до истечения срока действия токена
+type Denylist interface {
+	Add(ctx context.Context, jti string, expireAt time.Time) error
+	Contains(ctx context.Context, jti string) (bool, error)
+}
+
+// Хранилище моментов отзыва всех токенов пользователя
+type NotBeforeRepository interface {
+	Set(
+		ctx context.Context,
+		uuid string,
+		notBefore time.Time,
+		expire time.Duration,
+	) error
+
+	Get(ctx context.Context, uuid string) (time.Time, error)
 }
 
 type Jwt struct {
@@ -39,33 +165,63 @@ type Jwt struct {
 	accessExpire time.Duration
 	refreshExpire time.Duration
 
-	method jwt.SigningMethod
-
-	secret []byte
+	keys *KeyRing // ключи подписи access токенов
 
 	refreshLen int // длина refresh токена
+	opaqueLen int // длина непрозрачного access токена
+
+	// Формат access токенов по умолчанию: jwt или opaque
+	accessFormat string
+
+	sessions SessionPolicy
+	claims ClaimsPolicy
 
 	repo TokenRepository
+	notBefore NotBeforeRepository
+	denylist Denylist
+	opaque OpaqueTokenRepository
+	locker SessionLocker
+	claimsProvider ClaimsProvider
+	enricher ClaimsEnricher // может отсутствовать
 
 	logger log.Logger
 }
 
 func NewJwt(
 	repo TokenRepository,
+	notBefore NotBeforeRepository,
+	denylist Denylist,
+	opaque OpaqueTokenRepository,
+	locker SessionLocker,
+	claimsProvider ClaimsProvider,
+	enricher ClaimsEnricher,
 	accessExpire, refreshExpire time.Duration,
-	secret string,
+	accessFormat string,
+	sessions SessionPolicy,
+	claims ClaimsPolicy,
+	keys *KeyRing,
 	logger log.Logger,
 ) *Jwt {
 	return &Jwt{
 		repo: repo,
+		notBefore: notBefore,
+		denylist: denylist,
+		opaque: opaque,
+		locker: locker,
+		claimsProvider: claimsProvider,
+		enricher: enricher,
 
 		accessExpire: accessExpire,
 		refreshExpire: refreshExpire,
+		accessFormat: accessFormat,
+
+		sessions: sessions,
+		claims: claims,
 
-		method: jwt.GetSigningMethod("HS512"),
-		secret: []byte(secret),
+		keys: keys,
 
 		refreshLen: 32,
+		opaqueLen: 43,
 
 		logger: logger.WithFields(map[string]any{
 			"unit": "jwt",
@@ -76,39 +232,282 @@ func NewJwt(
 func (j *Jwt) CreateTokens(
 	ctx context.Context,
 	uuid string,
+	meta *dto.SessionMeta,
+	scope string,
+	client *entity.Client,
+	cnf *dto.Confirmation,
 ) (*dto.Tokens, error) {
-	return j.createTokens(ctx, uuid)
+
+	now := time.Now()
+
+	jkt, x5t := binding(cnf)
+
+	return j.createTokens(ctx, true, client, parseScope(scope), &entity.RefreshToken{
+		Uuid: uuid,
+		ClientId: clientId(client),
+		FamilyId: newId(),
+		UserAgent: meta.UserAgent,
+		ClientIp: meta.ClientIp,
+		DeviceName: meta.DeviceName,
+		CreatedAt: now,
+		LastRefreshedAt: now,
+		SessionExpireAt: j.sessionExpireAt(now),
+		Jkt: jkt,
+		X5t: x5t,
+	})
+}
+
+// Возвращает набор публичных ключей для проверки access токенов
+func (j *Jwt) Jwks(ctx context.Context) *dto.Jwks {
+
+	jwks := &dto.Jwks{
+		Keys: []dto.Jwk{},
+	}
+
+	for _, key := range j.keys.VerificationKeys() {
+		if jwk := key.Jwk(); jwk != nil {
+			jwks.Keys = append(jwks.Keys, *jwk)
+		}
+	}
+
+	return jwks
 }
 
 func (j *Jwt) RefreshTokens(
 	ctx context.Context,
 	tokens *dto.Tokens,
+	client *entity.Client,
+	cnf *dto.Confirmation,
 ) (*dto.Tokens, error) {
 
-	uuid, refreshId, _, err := j.parseAccess(ctx, tokens.Access)
+	claims, _, err := j.parseAccess(ctx, tokens.Access)
 	if err != nil {
 		return nil, errors.InvalidToken.New("invalid access token").Wrap(err)
 	}
 
-	err = j.validateRefreshToken(ctx, tokens.Refresh, refreshId)
+	refresh, err := j.validateRefreshToken(
+		ctx,
+		tokens.Refresh,
+		claims.RefreshId,
+		clientId(client),
+		cnf,
+	)
 	if err != nil {
+
+		if errutil.Has(err, errors.SessionExpired) ||
+			errutil.Has(err, errors.InvalidDPoPProof) {
+			return nil, err
+		}
+
 		return nil, errors.InvalidToken.New("invalid refresh token").Wrap(err)
 	}
 
-	return j.createTokens(ctx, uuid)
+	// Новый refresh токен продолжает семейство (сессию) предыдущего.
+	// Токены, выданные до появления семейств, начинают новое семейство
+	session := *refresh
+	session.Uuid = claims.Subject
+	session.LastRefreshedAt = time.Now()
+
+	if session.FamilyId == "" {
+		session.FamilyId = newId()
+		session.CreatedAt = session.LastRefreshedAt
+		session.SessionExpireAt = j.sessionExpireAt(session.CreatedAt)
+	}
+
+	// Области доступа можно только сузить
+	result, err := j.createTokens(
+		ctx,
+		false,
+		client,
+		parseScope(tokens.Scope),
+		&session,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Семейство могли отозвать (повторное использование) после проверки
+	// токена, но до сохранения нового: такой токен не выдается
+	if _, getErr := j.repo.GetById(ctx, refresh.Id); getErr != nil {
+
+		if err := j.repo.DeleteFamily(ctx, session.FamilyId); err != nil {
+			return nil, errors.Internal.NewDefault().Wrap(err)
+		}
+
+		if errutil.Has(getErr, errors.NotFound) {
+			return nil, errors.InvalidToken.New("session revoked")
+		}
+
+		return nil, errors.Internal.NewDefault().Wrap(getErr)
+	}
+
+	return result, nil
 }
 
+// Завершает сессию: удаляет семейство refresh токена, связанного
+// с access токеном
+func (j *Jwt) RevokeTokens(
+	ctx context.Context,
+	tokens *dto.Tokens,
+) error {
+
+	claims, _, err := j.parseAccess(ctx, tokens.Access)
+	if err != nil {
+		return errors.InvalidToken.New("invalid access token").Wrap(err)
+	}
+
+	refresh, err := j.checkRefreshToken(ctx, tokens.Refresh, claims.RefreshId)
+	if err != nil {
+		return errors.InvalidToken.New("invalid refresh token").Wrap(err)
+	}
+
+	// Удаляется все семейство: обновление пары, выполняемое одновременно
+	// с выходом, не оставит действующего преемника
+	if err := j.deleteSession(ctx, refresh); err != nil {
+		return errors.Internal.NewDefault().Wrap(err)
+	}
+
+	// Access токен перестает приниматься сразу, не дожидаясь истечения
+	return j.denyAccess(ctx, claims)
+}
+
+// Завершает все сессии пользователя, которому принадлежит пара токенов
+func (j *Jwt) RevokeAllTokens(
+	ctx context.Context,
+	tokens *dto.Tokens,
+) error {
+
+	claims, _, err := j.parseAccess(ctx, tokens.Access)
+	if err != nil {
+		return errors.InvalidToken.New("invalid access token").Wrap(err)
+	}
+
+	_, err = j.checkRefreshToken(ctx, tokens.Refresh, claims.RefreshId)
+	if err != nil {
+		return errors.InvalidToken.New("invalid refresh token").Wrap(err)
+	}
+
+	return j.RevokeSessions(ctx, claims.Subject)
+}
+
+// Проверяет access токен, предъявленный самому сервису: подпись,
+// срок действия, отзыв, аудиторию и привязку к ключу. presented -
+// ключи, владение которыми клиент подтвердил вместе с токеном.
+// Возвращает утверждения действительного токена
+func (j *Jwt) VerifyAccess(
+	ctx context.Context,
+	token string,
+	presented *dto.Confirmation,
+) (*AccessClaims, error) {
+
+	claims, err := j.verifyIssued(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := j.checkAudience(claims); err != nil {
+		return nil, err
+	}
+
+	if err := checkConfirmation(claims, presented); err != nil {
+
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"sub": claims.Subject,
+		}).Warn(err)
+
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Проверяет access токен, выданный сервисом для любой аудитории
+// (интроспекция, отзыв, обмен токенов)
+func (j *Jwt) verifyIssued(
+	ctx context.Context,
+	token string,
+) (*AccessClaims, error) {
+
+	claims, isExpired, err := j.parseAccess(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if isExpired {
+		return nil, errors.InvalidToken.New("token expired")
+	}
+
+	return claims, nil
+}
+
+// Отзывает все сессии пользователя: удаляет его refresh токены и
+// запрещает использование уже выданных access токенов
+func (j *Jwt) RevokeSessions(ctx context.Context, uuid string) error {
+
+	// Сначала запрещаем выданные access токены: параллельное обновление
+	// пары после этого момента уже не пройдет проверку. iat токенов
+	// хранится с точностью до секунды, поэтому и момент отзыва усекается:
+	// иначе токен, выданный при входе в ту же секунду после отзыва,
+	// считался бы отозванным
+	notBefore := time.Now().Truncate(time.Second)
+
+	err := j.notBefore.Set(ctx, uuid, notBefore, j.refreshExpire)
+	if err != nil {
+		return errors.Internal.NewDefault().Wrap(err)
+	}
+
+	if err := j.repo.DeleteByUuid(ctx, uuid); err != nil {
+		return errors.Internal.NewDefault().Wrap(err)
+	}
+
+	j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"uuid": uuid,
+	}).Info("all sessions revoked")
+
+	return nil
+}
+
+// Выпускает пару токенов для сессии. Для новой сессии (вход)
+// соблюдается лимит одновременных сессий пользователя
 func (j *Jwt) createTokens(
 	ctx context.Context,
-	uuid string,
+	newSession bool,
+	client *entity.Client,
+	scopes []string,
+	session *entity.RefreshToken,
 ) (*dto.Tokens, error) {
 
-	refresh, refreshId, err := j.createRefresh(ctx)
+	if newSession && j.sessions.MaxSessions > 0 {
+
+		unlock, err := j.locker.Lock(ctx, session.Uuid)
+		if err != nil {
+			return nil, errors.Internal.NewDefault().Wrap(err)
+		}
+
+		defer unlock()
+
+		if err := j.enforceSessionLimit(ctx, session.Uuid); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := j.grantScopes(ctx, newSession, session, client, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, refreshId, err := j.createRefresh(
+		ctx,
+		session,
+		j.refreshExpireFor(client),
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	access, err := j.createAccess(ctx, uuid, refreshId)
+	access, err := j.createAccess(ctx, session, client, nil, refreshId, user, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -116,26 +515,65 @@ func (j *Jwt) createTokens(
 	return &dto.Tokens{
 		Access: access,
 		Refresh: refresh,
+		ExpiresIn: j.expiresIn(client),
+		Scope: formatScope(session.Scopes),
+		TokenType: tokenType(session),
 	}, nil
 }
 
 func (j *Jwt) createAccess(
 	ctx context.Context,
-	uuid string,
+	session *entity.RefreshToken,
+	client *entity.Client,
+	audience []string, // nil - аудитории клиента
 	refreshId string,
+	user *entity.UserClaims,
+	act *Actor,
 ) (string, error) {
 
-	token := jwt.New(j.method)
+	extra, err := j.extraClaims(ctx, session)
+	if err != nil {
+		return "", err
+	}
 
-	token.Claims = &AccessClaims{
-		RegisteredClaims: &jwt.RegisteredClaims{
-			ExpiresAt: j.expiresAt(j.accessExpire),
-		},
-		Uuid: uuid,
+	registered := j.registeredClaims(session.Uuid, client)
+	if audience != nil {
+		registered.Audience = jwt.ClaimStrings(audience)
+	}
+
+	claims := &AccessClaims{
+		RegisteredClaims: registered,
+		Uuid: session.Uuid,
 		RefreshId: refreshId,
+		ClientId: clientId(client),
+		Scope: formatScope(session.Scopes),
+		Roles: user.Roles,
+		Permissions: user.Permissions,
+		Act: act,
+		Cnf: confirmation(session),
+		Extra: extra,
+	}
+
+	format := j.accessFormatFor(client)
+
+	if format == AccessTokenOpaque {
+		return j.createOpaque(ctx, claims, client)
+	}
+
+	if format != AccessTokenJwt {
+		return "", errors.Internal.New("unknown access token format: " + format)
+	}
+
+	key := j.keys.Active()
+
+	token := jwt.New(key.Method())
+	token.Claims = claims
+
+	if key.Id() != "" {
+		token.Header["kid"] = key.Id()
 	}
 
-	result, err := token.SignedString(j.secret)
+	result, err := token.SignedString(key.signKey)
 	if err != nil {
 
 		j.logger.WithFields(map[string]any{
@@ -148,7 +586,11 @@ func (j *Jwt) createAccess(
 	return result, nil
 }
 
-func (j *Jwt) createRefresh(ctx context.Context) (string, string, error) {
+func (j *Jwt) createRefresh(
+	ctx context.Context,
+	session *entity.RefreshToken,
+	expire time.Duration,
+) (string, string, error) {
 
 	// Генерируем случайный токен
 	token, err := j.generateRandomToken(ctx, j.refreshLen)
@@ -157,7 +599,7 @@ func (j *Jwt) createRefresh(ctx context.Context) (string, string, error) {
 	}
 
 	// Сохраняем токен в базу
-	refreshId, err := j.saveRefresh(ctx, token)
+	refreshId, err := j.saveRefresh(ctx, token, session, expire)
 	if err != nil {
 		j.logger.WithFields(map[string]any{
 			"req_id": reqid.FromContext(ctx),
@@ -169,7 +611,12 @@ func (j *Jwt) createRefresh(ctx context.Context) (string, string, error) {
 	return token, refreshId, nil
 }
 
-func (j *Jwt) saveRefresh(ctx context.Context, token string) (string, error) {
+func (j *Jwt) saveRefresh(
+	ctx context.Context,
+	token string,
+	session *entity.RefreshToken,
+	expire time.Duration,
+) (string, error) {
 
 	hashedToken, err := j.hash(token)
 	if err != nil {
@@ -180,7 +627,15 @@ func (j *Jwt) saveRefresh(ctx context.Context, token string) (string, error) {
 		return "", errors.Internal.New("hash refresh").Wrap(err)
 	}
 
-	refreshId, err := j.repo.Save(ctx, hashedToken, j.refreshExpire)
+	refresh := *session
+	refresh.Id = ""
+	refresh.Token = hashedToken
+	refresh.Lookup = lookupHash(token)
+	refresh.Rotated = false
+
+	refresh.ExpireAt = time.Now().Add(time.Minute * expire)
+
+	refreshId, err := j.repo.Save(ctx, &refresh)
 	if err != nil {
 
 		j.logger.WithFields(map[string]any{
@@ -215,34 +670,150 @@ func (j *Jwt) generateRandomToken(
 	return base64.URLEncoding.EncodeToString(b)[:length], nil
 }
 
+// Разбирает access токен (jwt или непрозрачный) и проверяет, что он
+// не отозван. Истекший токен не считается ошибкой: он нужен для
+// обновления пары
 func (j *Jwt) parseAccess(
 	ctx context.Context,
 	token string,
-) (string, string, bool, error) {
+) (*AccessClaims, bool, error) {
 
-	var isExpired bool = false
+	parse := j.parseSigned
+	if isOpaque(token) {
+		parse = j.parseOpaque
+	}
 
-	claims, isExpired, err := j.parseClaims(ctx, token, &AccessClaims{})
+	accessClaims, isExpired, err := parse(ctx, token)
 	if err != nil {
 
 		j.logger.WithFields(map[string]any{
 			"req_id": reqid.FromContext(ctx),
 		}).Warnf("parse: %s", err.Error())
 
-		return "", "", false, err
+		return nil, false, err
+	}
+
+	// Токены, выданные до появления sub, содержат только uuid
+	if accessClaims.Subject == "" {
+		accessClaims.Subject = accessClaims.Uuid
+	}
+
+	if accessClaims.Subject == "" {
+		return nil, false, errors.InvalidToken.New("missing subject")
+	}
+
+	if err := j.checkNotBefore(ctx, accessClaims); err != nil {
+		return nil, false, err
+	}
+
+	if err := j.checkDenylist(ctx, accessClaims); err != nil {
+		return nil, false, err
+	}
+
+	return accessClaims, isExpired, nil
+}
+
+// Разбирает и проверяет подписанный access токен (jwt)
+func (j *Jwt) parseSigned(
+	ctx context.Context,
+	token string,
+) (*AccessClaims, bool, error) {
+
+	claims, isExpired, err := j.parseClaims(ctx, token, &AccessClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{},
+	})
+
+	if err != nil {
+		return nil, false, err
 	}
 
 	accessClaims, ok := claims.(*AccessClaims)
 	if !ok {
+		return nil, false, errors.InvalidToken.New("invalid token type")
+	}
+
+	return accessClaims, isExpired, nil
+}
+
+// Проверяет, что токен не находится в списке отозванных
+func (j *Jwt) checkDenylist(
+	ctx context.Context,
+	claims *AccessClaims,
+) error {
+
+	// Токены, выданные до появления jti, отозвать по отдельности нельзя
+	if claims.ID == "" {
+		return nil
+	}
+
+	denied, err := j.denylist.Contains(ctx, claims.ID)
+	if err != nil {
+		return errors.Internal.NewDefault().Wrap(err)
+	}
+
+	if denied {
 
 		j.logger.WithFields(map[string]any{
 			"req_id": reqid.FromContext(ctx),
-		}).Warnf("parse claims error")
+			"jti": claims.ID,
+		}).Warn("denylisted token")
 
-		return "", "", false, errors.InvalidToken.New("invalid token type")
+		return errors.InvalidToken.New("token revoked")
 	}
 
-	return accessClaims.Uuid, accessClaims.RefreshId, isExpired, nil
+	return nil
+}
+
+// Добавляет access токен в список отозванных до истечения его срока
+func (j *Jwt) denyAccess(ctx context.Context, claims *AccessClaims) error {
+
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	// Истекший токен и так не будет принят
+	if claims.ExpiresAt.Before(time.Now()) {
+		return nil
+	}
+
+	err := j.denylist.Add(ctx, claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		return errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return nil
+}
+
+// Проверяет, что токен выдан после последнего отзыва
+// всех сессий пользователя
+func (j *Jwt) checkNotBefore(
+	ctx context.Context,
+	claims *AccessClaims,
+) error {
+
+	notBefore, err := j.notBefore.Get(ctx, claims.Subject)
+	if err != nil {
+		return errors.Internal.NewDefault().Wrap(err)
+	}
+
+	if notBefore.IsZero() {
+		return nil
+	}
+
+	// Токены без iat выданы до появления отзыва всех сессий. Токены,
+	// выданные в секунду отзыва, принимаются: их нельзя отличить от
+	// выданных сразу после него
+	if claims.IssuedAt == nil || claims.IssuedAt.Before(notBefore) {
+
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"uuid": claims.Subject,
+		}).Warn("token issued before sessions revocation")
+
+		return errors.InvalidToken.New("token revoked")
+	}
+
+	return nil
 }
 
 func (j *Jwt) parseClaims(
@@ -251,17 +822,61 @@ func (j *Jwt) parseClaims(
 	claims jwt.Claims,
 ) (jwt.Claims, bool, error) {
 
-	parsedToken, err := jwt.ParseWithClaims(
-		token,
-		claims,
-		func(token *jwt.Token) (interface{}, error) {
-			return j.secret, nil
-		},
+	// Ключи, которыми мог быть подписан токен, и проверяемый сейчас
+	var (
+		keys	[]*Key
+		current	int
 	)
 
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+
+		if keys == nil {
+			keys = j.findKeys(token)
+		}
+
+		if current >= len(keys) {
+			return nil, errors.InvalidToken.New("unknown signing key")
+		}
+
+		key := keys[current]
+		if !key.Accepts(token) {
+			return nil, errors.InvalidToken.New("unexpected signing method")
+		}
+
+		return key.verifyKey, nil
+	}
+
+	// Ключи перебираются, пока подпись не совпадет
+	parse := func(strict bool) (*jwt.Token, error) {
+
+		for current = 0; ; current++ {
+
+			parsedToken, err := jwt.ParseWithClaims(
+				token,
+				claims,
+				keyFunc,
+				j.parserOptions(strict)...,
+			)
+
+			if !errutil.Is(err, jwt.ErrTokenSignatureInvalid) ||
+				current + 1 >= len(keys) {
+				return parsedToken, err
+			}
+		}
+	}
+
+	parsedToken, err := parse(true)
+
+	// Токены, выданные до появления iss и aud, проверяются без них
+	if err != nil && parsedToken != nil && isLegacyClaims(parsedToken.Claims) &&
+		errutil.Is(err, jwt.ErrTokenInvalidIssuer) {
+
+		parsedToken, err = parse(false)
+	}
+
 	if err != nil {
 
-		if errutil.Is(err, jwt.ErrTokenExpired) {
+		if isOnlyExpired(err) {
 			return parsedToken.Claims, true, nil
 		}
 
@@ -275,40 +890,250 @@ func (j *Jwt) parseClaims(
 	return parsedToken.Claims, false, nil
 }
 
-// Функция валидации refresh токена
+// Ищет ключи проверки подписи по заголовку kid. Токены без kid
+// подписаны секретом без key_id или выданы до появления kid: они
+// проверяются всеми ключами без идентификатора с тем же алгоритмом
+// (сначала активным, затем выведенными), а если таких нет - активным
+func (j *Jwt) findKeys(token *jwt.Token) []*Key {
+
+	kid, _ := token.Header["kid"].(string)
+	if kid != "" {
+
+		key := j.keys.Find(kid)
+		if key == nil {
+			return []*Key{}
+		}
+
+		return []*Key{key}
+	}
+
+	keys := []*Key{}
+
+	for _, key := range j.keys.VerificationKeys() {
+		if key.Id() == "" && key.Accepts(token) {
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return []*Key{j.keys.Active()}
+	}
+
+	return keys
+}
+
+func (j *Jwt) validMethods() []string {
+
+	var methods []string
+
+	for _, key := range j.keys.VerificationKeys() {
+		methods = append(methods, key.Method().Alg())
+	}
+
+	return methods
+}
+
+// Функция валидации refresh токена. Возвращает использованный токен
 func (j *Jwt) validateRefreshToken(
 	ctx context.Context,
 	refresh string,
 	refreshId string,
-) error {
+	clientId string,
+	cnf *dto.Confirmation,
+) (*entity.RefreshToken, error) {
 
-	// Получаем хеш токена по id
-	hashedRefresh, err := j.repo.GetById(ctx, refreshId)
+	token, err := j.checkRefreshToken(ctx, refresh, refreshId)
 	if err != nil {
+		return nil, err
+	}
+
+	// Обновить пару может только клиент, которому она выдана
+	if token.ClientId != clientId {
+
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"refresh_id": refreshId,
+			"client_id": clientId,
+		}).Warn("refresh token issued to another client")
+
+		return nil, errors.InvalidToken.New("token issued to another client")
+	}
+
+	// Пару, привязанную к ключу или сертификату, может обновить только
+	// его владелец. Проверка выполняется до пометки токена как использованного
+	jkt, x5t := binding(cnf)
+
+	if token.Jkt != "" && token.Jkt != jkt {
 
-		logger := j.logger.WithFields(map[string]any{
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"refresh_id": refreshId,
+		}).Warn("dpop key mismatch")
+
+		return nil, errors.InvalidDPoPProof.New(
+			"dpop proof with the session key is required",
+		)
+	}
+
+	if token.X5t != "" && token.X5t != x5t {
+
+		j.logger.WithFields(map[string]any{
 			"req_id": reqid.FromContext(ctx),
 			"refresh_id": refreshId,
-		})
+		}).Warn("client certificate mismatch")
+
+		return nil, errors.InvalidToken.New(
+			"session is bound to another client certificate",
+		)
+	}
+
+	// Сессия, превысившая абсолютный срок или время бездействия,
+	// завершается целиком
+	if err := j.checkSessionExpiry(ctx, token); err != nil {
+
+		if err := j.deleteSession(ctx, token); err != nil {
+			return nil, errors.Internal.NewDefault().Wrap(err)
+		}
+
+		return nil, err
+	}
+
+	// Документ удаляется по TTL индексу с задержкой
+	if !time.Now().Before(token.ExpireAt) {
+		return nil, errors.InvalidToken.New("refresh token expired")
+	}
+
+	// Атомарно помечаем токен как использованный: при одновременных
+	// запросах с одним и тем же токеном успешен только один из них.
+	// Токен был действителен при чтении, поэтому проигравший гонку
+	// запрос не считается повторным использованием и не отзывает
+	// семейство вместе с парой, выданной победителю
+	err = j.repo.Consume(ctx, refreshId, token.Token)
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+
+			j.logger.WithFields(map[string]any{
+				"req_id": reqid.FromContext(ctx),
+				"refresh_id": refreshId,
+			}).Warn("token already consumed by a concurrent request")
+
+			return nil, errors.InvalidToken.NewDefault().Wrap(err)
+		}
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	return token, nil
+}
+
+// Проверяет, что refresh токен существует, соответствует хешу
+// из БД и не был использован ранее
+func (j *Jwt) checkRefreshToken(
+	ctx context.Context,
+	refresh string,
+	refreshId string,
+) (*entity.RefreshToken, error) {
+
+	logger := j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"refresh_id": refreshId,
+	})
+
+	// Токены, выданные без refresh токена (client credentials)
+	if refreshId == "" {
+		return nil, errors.InvalidToken.New("token has no refresh token")
+	}
+
+	// Получаем токен по id
+	token, err := j.repo.GetById(ctx, refreshId)
+	if err != nil {
 
 		if errutil.Has(err, errors.NotFound) {
 			logger.Warn("token not found")
 
-			return errors.InvalidToken.NewDefault().Wrap(err)
+			return nil, errors.InvalidToken.NewDefault().Wrap(err)
 		}
 
 		logger.Error("get token error")
 
-		return errors.Internal.NewDefault().Wrap(err)
+		return nil, errors.Internal.NewDefault().Wrap(err)
 	}
 
 	// Сравниваем хеш с токеном
-	if err := j.hashCompare(hashedRefresh, refresh); err != nil {
-		return errors.InvalidToken.NewDefault().Wrap(err)
+	if err := j.hashCompare(token.Token, refresh); err != nil {
+		return nil, errors.InvalidToken.NewDefault().Wrap(err)
+	}
+
+	// Повторное предъявление уже обмененного токена
+	if token.Rotated {
+		return nil, j.revokeFamily(ctx, token)
+	}
+
+	return token, nil
+}
+
+// Отзывает все семейство повторно использованного refresh токена:
+// неизвестно, кто из предъявивших токен является его владельцем
+// (OAuth 2.0 Security BCP, refresh token rotation)
+func (j *Jwt) revokeFamily(
+	ctx context.Context,
+	token *entity.RefreshToken,
+) error {
+
+	logger := j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"event": "refresh_token_reuse",
+		"refresh_id": token.Id,
+		"family_id": token.FamilyId,
+	})
+
+	logger.Warn("security event: reuse of rotated refresh token detected")
+
+	reuseErr := errors.InvalidToken.New("refresh token reuse detected")
+
+	// Токены, выданные до появления семейств, отзывать нечего
+	if token.FamilyId == "" {
+		return reuseErr
+	}
+
+	if err := j.repo.DeleteFamily(ctx, token.FamilyId); err != nil {
+		logger.Errorf("revoke family: %s", err)
+
+		return errors.Internal.NewDefault().Wrap(err)
 	}
 
-	// Удаляем токен из БД
-	return j.repo.Delete(ctx, refreshId)
+	logger.Warn("refresh token family revoked")
+
+	return reuseErr
+}
+
+// Удаляет все refresh токены сессии. Токен, выданный до появления
+// семейств, удаляется отдельно
+func (j *Jwt) deleteSession(
+	ctx context.Context,
+	token *entity.RefreshToken,
+) error {
+
+	if token.FamilyId == "" {
+		return j.repo.Delete(ctx, token.Id)
+	}
+
+	return j.repo.DeleteFamily(ctx, token.FamilyId)
+}
+
+// Случайный уникальный идентификатор (семейства токенов, jti)
+func newId() string {
+	return uuid.New().String()
+}
+
+// SHA-256 refresh токена для поиска в БД. Refresh токен - случайная
+// строка достаточной длины, поэтому быстрого хеша для поиска достаточно
+func lookupHash(token string) string {
+
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
 }
 
 func (j *Jwt) hash(data string) (string, error) {
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"sync"
+	"time"
+	"context"
+	"testing"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Из N одновременных обновлений одной пары успешно ровно одно.
+// Проигравшие гонку запросы отклоняются, но не отзывают семейство:
+// пара победителя остается действительной
+func TestConcurrentRefresh(t *testing.T) {
+
+	const n = 8
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg			sync.WaitGroup
+		mu			sync.Mutex
+		succeeded	[]*dto.Tokens
+		rejected	int
+	)
+
+	start := make(chan struct{})
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			<-start
+
+			pair, err := j.RefreshTokens(ctx, tokens, testClient, nil)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+				case err == nil:
+					succeeded = append(succeeded, pair)
+
+				case hasInfo(err, "refresh token reuse detected"):
+					t.Errorf("lost race treated as reuse: %s", err)
+
+				case errutil.Has(err, errors.InvalidToken):
+					rejected++
+
+				default:
+					t.Errorf("unexpected error: %s", err)
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+
+	if len(succeeded) != 1 || rejected != n - 1 {
+		t.Fatalf("succeeded = %d, rejected = %d, want 1 and %d",
+			len(succeeded), rejected, n - 1)
+	}
+
+	if _, err := j.RefreshTokens(ctx, succeeded[0], testClient, nil); err != nil {
+		t.Fatalf("refresh winner pair: %s", err)
+	}
+}
+
+// Семейство отозвано между проверкой токена и сохранением нового:
+// новая пара не выдается и не остается в хранилище
+func TestRefreshRacingRevocation(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	familyId := j.tokens.familyId()
+
+	j.tokens.onSave = func() {
+		j.tokens.onSave = nil
+		j.tokens.DeleteFamily(ctx, familyId)
+	}
+
+	_, err = j.RefreshTokens(ctx, tokens, testClient, nil)
+	if !hasInfo(err, "session revoked") {
+		t.Fatalf("err = %v, want session revoked", err)
+	}
+
+	if size := j.tokens.family(familyId); size != 0 {
+		t.Fatalf("family has %d tokens after revocation", size)
+	}
+}
+
+// Повторное предъявление уже обмененного refresh токена
+// отзывает все семейство
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	first, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := j.RefreshTokens(ctx, first, testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = j.RefreshTokens(ctx, first, testClient, nil)
+	if !hasInfo(err, "refresh token reuse detected") {
+		t.Fatalf("err = %v, want reuse", err)
+	}
+
+	if _, err := j.RefreshTokens(ctx, second, testClient, nil); err == nil {
+		t.Fatal("refresh of revoked family succeeded")
+	}
+}
+
+// Выход удаляет все семейство сессии, а не только текущий токен
+func TestRevokeTokensDeletesFamily(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	first, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := j.RefreshTokens(ctx, first, testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	familyId := j.tokens.familyId()
+
+	if err := j.RevokeTokens(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := j.tokens.family(familyId); size != 0 {
+		t.Fatalf("family has %d tokens after logout", size)
+	}
+}
+
+// Вход в ту же секунду, что и завершение всех сессий, создает
+// действующую сессию, а токены, выданные раньше, отклоняются
+func TestSignInAfterRevokeSessions(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	old, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Токен выдан в предыдущую секунду
+	j.notBefore.values["user-1"] = time.Now().Add(time.Second).Truncate(time.Second)
+
+	if _, err := j.VerifyAccess(ctx, old.Access, nil); err == nil {
+		t.Fatal("token issued before revocation accepted")
+	}
+
+	if err := j.RevokeSessions(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.VerifyAccess(ctx, tokens.Access, nil); err != nil {
+		t.Fatalf("new session rejected: %s", err)
+	}
+
+	if _, err := j.RefreshTokens(ctx, tokens, testClient, nil); err != nil {
+		t.Fatalf("new session refresh: %s", err)
+	}
+}
+
+// Сессия, созданная до появления областей доступа, при обновлении
+// получает области клиента, а не теряет доступ
+func TestRefreshLegacySessionScopes(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j.tokens.mu.Lock()
+	for _, token := range j.tokens.tokens {
+		token.Scopes = nil
+	}
+	j.tokens.mu.Unlock()
+
+	refreshed, err := j.RefreshTokens(ctx, tokens, testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if refreshed.Scope != "read write" {
+		t.Fatalf("scope = %q, want %q", refreshed.Scope, "read write")
+	}
+
+	// Дальше сессия сужается как обычно
+	refreshed.Scope = "read"
+
+	narrowed, err := j.RefreshTokens(ctx, refreshed, testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	narrowed.Scope = "read write"
+
+	if _, err := j.RefreshTokens(ctx, narrowed, testClient, nil); err == nil {
+		t.Fatal("legacy session widened after narrowing")
+	}
+}
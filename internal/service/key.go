@@ -0,0 +1,341 @@
+package service
+
+import (
+	"os"
+	"fmt"
+	"crypto"
+	"math/big"
+	"crypto/rsa"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/ed25519"
+	"encoding/json"
+	"encoding/base64"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+)
+
+// Ключ, которым подписываются и проверяются access токены
+type Key struct {
+	id			string // идентификатор ключа (kid)
+	method		jwt.SigningMethod
+
+	signKey		any // ключ подписи (секрет или приватный ключ)
+	verifyKey	any // ключ проверки подписи (секрет или публичный ключ)
+}
+
+// Создает ключ для указанного алгоритма. Для HS512 используется секрет,
+// для асимметричных алгоритмов (RS256, ES256, EdDSA) - приватный ключ
+// в формате PEM, расположенный по пути privateKeyPath.
+// Если id не указан, идентификатор асимметричного ключа вычисляется
+// из публичного ключа, а у секрета идентификатора нет
+func LoadKey(id, algorithm, secret, privateKeyPath string) (*Key, error) {
+
+	key, err := loadKey(algorithm, secret, privateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if id != "" {
+		key.id = id
+	}
+
+	return key, nil
+}
+
+func loadKey(algorithm, secret, privateKeyPath string) (*Key, error) {
+
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+
+		if secret == "" {
+			return nil, fmt.Errorf("empty secret for %s", algorithm)
+		}
+
+		// Идентификатор, вычисленный из секрета, позволял бы подбирать
+		// секрет по заголовку любого токена, поэтому у секрета его нет
+		return &Key{
+			method: method,
+			signKey: []byte(secret),
+			verifyKey: []byte(secret),
+		}, nil
+	}
+
+	data, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %s", err)
+	}
+
+	return NewKey(method, data)
+}
+
+// Создает асимметричный ключ из приватного ключа в формате PEM
+func NewKey(method jwt.SigningMethod, privatePEM []byte) (*Key, error) {
+
+	var (
+		signKey		crypto.Signer
+		err			error
+	)
+
+	switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			signKey, err = jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+
+		case *jwt.SigningMethodECDSA:
+			signKey, err = parseECPrivateKey(method, privatePEM)
+
+		case *jwt.SigningMethodEd25519:
+			var key crypto.PrivateKey
+
+			key, err = jwt.ParseEdPrivateKeyFromPEM(privatePEM)
+			if err == nil {
+				signKey = key.(crypto.Signer)
+			}
+
+		default:
+			return nil, fmt.Errorf(
+				"unsupported signing algorithm: %s", method.Alg(),
+			)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parse %s private key: %s", method.Alg(), err)
+	}
+
+	key := &Key{
+		method: method,
+		signKey: signKey,
+		verifyKey: signKey.Public(),
+	}
+
+	// Идентификатор асимметричного ключа - его отпечаток (RFC 7638)
+	key.id, err = thumbprint(key.Jwk())
+	if err != nil {
+		return nil, fmt.Errorf("key thumbprint: %s", err)
+	}
+
+	return key, nil
+}
+
+func (k *Key) Id() string {
+	return k.id
+}
+
+func (k *Key) Method() jwt.SigningMethod {
+	return k.method
+}
+
+// Возвращает публичную часть ключа в формате JWK.
+// Для симметричных ключей возвращает nil: их нельзя публиковать
+func (k *Key) Jwk() *dto.Jwk {
+
+	jwk := publicJwk(k.verifyKey)
+	if jwk == nil {
+		return nil
+	}
+
+	jwk.Kid = k.id
+	jwk.Alg = k.method.Alg()
+	jwk.Use = "sig"
+
+	return jwk
+}
+
+// Симметричный ключ (HS512): подпись может проверить только сам сервис
+func (k *Key) Symmetric() bool {
+
+	_, ok := k.method.(*jwt.SigningMethodHMAC)
+
+	return ok
+}
+
+// Проверяет, что ключ подходит для алгоритма из заголовка токена
+func (k *Key) Accepts(token *jwt.Token) bool {
+	return token.Method != nil && token.Method.Alg() == k.method.Alg()
+}
+
+// Для ES256/ES384/ES512 кривая ключа должна соответствовать алгоритму
+func parseECPrivateKey(
+	method jwt.SigningMethod,
+	privatePEM []byte,
+) (crypto.Signer, error) {
+
+	key, err := jwt.ParseECPrivateKeyFromPEM(privatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaMethod := method.(*jwt.SigningMethodECDSA)
+
+	if key.Curve.Params().BitSize != ecdsaMethod.CurveBits {
+		return nil, fmt.Errorf(
+			"curve %s does not match %s",
+			key.Curve.Params().Name, method.Alg(),
+		)
+	}
+
+	return key, nil
+}
+
+// Формирует JWK (без kid, alg и use) из публичного ключа
+func publicJwk(key any) *dto.Jwk {
+
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch k := key.(type) {
+		case *rsa.PublicKey:
+			return &dto.Jwk{
+				Kty: "RSA",
+				N: encode(k.N.Bytes()),
+				E: encode(big.NewInt(int64(k.E)).Bytes()),
+			}
+
+		case *ecdsa.PublicKey:
+			// Координаты дополняются нулями до размера кривой (RFC 7518)
+			size := (k.Curve.Params().BitSize + 7) / 8
+
+			return &dto.Jwk{
+				Kty: "EC",
+				Crv: k.Curve.Params().Name,
+				X: encode(k.X.FillBytes(make([]byte, size))),
+				Y: encode(k.Y.FillBytes(make([]byte, size))),
+			}
+
+		case ed25519.PublicKey:
+			return &dto.Jwk{
+				Kty: "OKP",
+				Crv: "Ed25519",
+				X: encode(k),
+			}
+
+		default:
+			return nil
+	}
+}
+
+// Восстанавливает публичный ключ из JWK (обратное к publicJwk)
+func jwkPublicKey(jwk *dto.Jwk) (any, error) {
+
+	decode := func(value string) (*big.Int, error) {
+
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("invalid key parameter")
+		}
+
+		return new(big.Int).SetBytes(data), nil
+	}
+
+	switch jwk.Kty {
+		case "RSA":
+			n, err := decode(jwk.N)
+			if err != nil {
+				return nil, err
+			}
+
+			e, err := decode(jwk.E)
+			if err != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("invalid rsa exponent")
+			}
+
+			return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+		case "EC":
+			var curve elliptic.Curve
+
+			switch jwk.Crv {
+				case "P-256":
+					curve = elliptic.P256()
+
+				case "P-384":
+					curve = elliptic.P384()
+
+				case "P-521":
+					curve = elliptic.P521()
+
+				default:
+					return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+			}
+
+			x, err := decode(jwk.X)
+			if err != nil {
+				return nil, err
+			}
+
+			y, err := decode(jwk.Y)
+			if err != nil {
+				return nil, err
+			}
+
+			if !curve.IsOnCurve(x, y) {
+				return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+			}
+
+			return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+		case "OKP":
+			if jwk.Crv != "Ed25519" {
+				return nil, fmt.Errorf("unsupported curve: %s", jwk.Crv)
+			}
+
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid ed25519 key")
+			}
+
+			return ed25519.PublicKey(x), nil
+
+		default:
+			return nil, fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+}
+
+// Вычисляет отпечаток JWK (RFC 7638)
+func thumbprint(jwk *dto.Jwk) (string, error) {
+
+	// Обязательные поля в лексикографическом порядке
+	var members any
+
+	switch jwk.Kty {
+		case "RSA":
+			members = struct {
+				E	string	`json:"e"`
+				Kty	string	`json:"kty"`
+				N	string	`json:"n"`
+			}{jwk.E, jwk.Kty, jwk.N}
+
+		case "EC":
+			members = struct {
+				Crv	string	`json:"crv"`
+				Kty	string	`json:"kty"`
+				X	string	`json:"x"`
+				Y	string	`json:"y"`
+			}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+
+		case "OKP":
+			members = struct {
+				Crv	string	`json:"crv"`
+				Kty	string	`json:"kty"`
+				X	string	`json:"x"`
+			}{jwk.Crv, jwk.Kty, jwk.X}
+
+		default:
+			return "", fmt.Errorf("unsupported key type: %s", jwk.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
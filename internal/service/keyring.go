@@ -0,0 +1,81 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// Ключ, выведенный из использования: токены, подписанные им,
+// принимаются до момента RetireAt
+type RetiredKey struct {
+	Key			*Key
+	RetireAt	time.Time
+}
+
+// Набор ключей подписи: один активный ключ, которым подписываются
+// новые токены, и выведенные из использования ключи, которые принимаются
+// только при проверке подписи. Набор можно заменить без перезапуска
+type KeyRing struct {
+	mu		sync.RWMutex
+
+	active	*Key
+	retired	[]RetiredKey
+}
+
+func NewKeyRing(active *Key, retired ...RetiredKey) *KeyRing {
+	return &KeyRing{
+		active: active,
+		retired: retired,
+	}
+}
+
+// Заменяет активный ключ и набор выведенных из использования ключей
+func (r *KeyRing) Rotate(active *Key, retired ...RetiredKey) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active = active
+	r.retired = retired
+}
+
+// Возвращает ключ, которым подписываются новые токены
+func (r *KeyRing) Active() *Key {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.active
+}
+
+// Ищет ключ проверки подписи по идентификатору (kid).
+// Возвращает nil, если ключ не найден или срок его действия истек
+func (r *KeyRing) Find(kid string) *Key {
+
+	for _, key := range r.VerificationKeys() {
+		if key.Id() == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// Возвращает активный ключ и все еще действующие выведенные ключи
+func (r *KeyRing) VerificationKeys() []*Key {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+
+	keys := []*Key{r.active}
+
+	for _, retired := range r.retired {
+		if now.Before(retired.RetireAt) {
+			keys = append(keys, retired.Key)
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"time"
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+)
+
+func tokenKid(t *testing.T, token string) string {
+
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &AccessClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kid, _ := parsed.Header["kid"].(string)
+
+	return kid
+}
+
+// Пара, выданная до ротации, обновляется: старый ключ принимается
+// как выведенный, а новая пара подписывается новым активным ключом
+func TestRefreshAfterKeyRotation(t *testing.T) {
+
+	ctx := context.Background()
+
+	a := newTestKey(t)
+	b := newTestKey(t)
+
+	j := newTestJwt(t, a)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid := tokenKid(t, tokens.Access); kid != a.Id() {
+		t.Fatalf("kid = %q, want %q", kid, a.Id())
+	}
+
+	j.keys.Rotate(b, RetiredKey{Key: a, RetireAt: time.Now().Add(time.Hour)})
+
+	refreshed, err := j.RefreshTokens(ctx, tokens, testClient, nil)
+	if err != nil {
+		t.Fatalf("refresh after rotation: %s", err)
+	}
+
+	if kid := tokenKid(t, refreshed.Access); kid != b.Id() {
+		t.Fatalf("kid = %q, want %q", kid, b.Id())
+	}
+
+	if _, err := j.VerifyAccess(ctx, refreshed.Access, nil); err != nil {
+		t.Fatalf("verify refreshed token: %s", err)
+	}
+}
+
+// После retire_at токены старого ключа не принимаются
+func TestRetiredKeyExpires(t *testing.T) {
+
+	ctx := context.Background()
+
+	a := newTestKey(t)
+	j := newTestJwt(t, a)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j.keys.Rotate(newTestKey(t), RetiredKey{Key: a, RetireAt: time.Now().Add(-time.Second)})
+
+	if _, err := j.RefreshTokens(ctx, tokens, testClient, nil); err == nil {
+		t.Fatal("refresh with expired retired key succeeded")
+	}
+}
+
+// Токены, подписанные секретом HS512, выдаются без kid
+func TestSecretKeyWithoutKid(t *testing.T) {
+
+	ctx := context.Background()
+
+	key, err := LoadKey("", "HS512", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := newTestJwt(t, key)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid := tokenKid(t, tokens.Access); kid != "" {
+		t.Fatalf("secret key published kid %q", kid)
+	}
+
+	if _, err := j.RefreshTokens(ctx, tokens, testClient, nil); err != nil {
+		t.Fatalf("refresh: %s", err)
+	}
+}
+
+// Секрет HS512 без key_id сменяется другим таким же секретом: токены
+// без kid проверяются всеми действующими секретами, а не только первым
+func TestSecretRotationWithoutKid(t *testing.T) {
+
+	ctx := context.Background()
+
+	a, err := LoadKey("", "HS512", "secret-a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := LoadKey("", "HS512", "secret-b", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := newTestJwt(t, a)
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j.keys.Rotate(b, RetiredKey{Key: a, RetireAt: time.Now().Add(time.Hour)})
+
+	if _, err := j.VerifyAccess(ctx, tokens.Access, nil); err != nil {
+		t.Fatalf("verify token of retired secret: %s", err)
+	}
+
+	refreshed, err := j.RefreshTokens(ctx, tokens, testClient, nil)
+	if err != nil {
+		t.Fatalf("refresh after rotation: %s", err)
+	}
+
+	if _, err := j.VerifyAccess(ctx, refreshed.Access, nil); err != nil {
+		t.Fatalf("verify token of active secret: %s", err)
+	}
+
+	// Выведенный секрет истек - его токены больше не принимаются
+	j.keys.Rotate(b, RetiredKey{Key: a, RetireAt: time.Now().Add(-time.Second)})
+
+	if _, err := j.VerifyAccess(ctx, tokens.Access, nil); err == nil {
+		t.Fatal("token of expired secret accepted")
+	}
+}
+
+// С симметричным ключом область openid не выдается и метаданные
+// OpenID провайдера недоступны: ID токен нельзя подписать секретом сервиса
+func TestOpenIdRequiresAsymmetricKey(t *testing.T) {
+
+	ctx := context.Background()
+
+	secret, err := LoadKey("", "HS512", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := newTestJwt(t, secret)
+	j.claimsProvider = staticClaims{&entity.UserClaims{
+		Scopes: []string{ScopeOpenId, "read", "write"},
+	}}
+
+	client := *testClient
+	client.Scopes = []string{ScopeOpenId, "read", "write"}
+
+	_, err = j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "openid read", &client, nil)
+	if err == nil {
+		t.Fatal("openid scope granted with a symmetric key")
+	}
+
+	tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", &client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if containsScope(parseScope(tokens.Scope), ScopeOpenId) {
+		t.Fatalf("scope = %q, want no openid", tokens.Scope)
+	}
+
+	if _, err := j.OpenIdConfiguration(ctx); err == nil {
+		t.Fatal("discovery served with a symmetric key")
+	}
+
+	// С асимметричным ключом OpenID Connect доступен
+	j.keys.Rotate(newTestKey(t))
+
+	tokens, err = j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "openid read", &client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idToken, err := j.IdToken(ctx, &client, "user-1", "", time.Time{}, tokens)
+	if err != nil || idToken == "" {
+		t.Fatalf("id token = %q, err = %v", idToken, err)
+	}
+}
+
+// Без issuer OpenID Connect отключен даже с асимметричным ключом:
+// iss обязателен в ID токене и метаданных
+func TestOpenIdRequiresIssuer(t *testing.T) {
+
+	ctx := context.Background()
+
+	j := newTestJwt(t, nil)
+	j.claims.Issuer = ""
+	j.claimsProvider = staticClaims{&entity.UserClaims{
+		Scopes: []string{ScopeOpenId, "read"},
+	}}
+
+	client := *testClient
+	client.Scopes = []string{ScopeOpenId, "read"}
+
+	if _, err := j.OpenIdConfiguration(ctx); err == nil {
+		t.Fatal("discovery served without issuer")
+	}
+
+	_, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "openid read", &client, nil)
+	if err == nil {
+		t.Fatal("openid scope granted without issuer")
+	}
+}
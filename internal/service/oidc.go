@@ -0,0 +1,183 @@
+package service
+
+import (
+	"time"
+	"crypto"
+	"context"
+	"strings"
+	"encoding/base64"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Область доступа, при которой выдается ID токен
+const ScopeOpenId = "openid"
+
+// Утверждения пользователя, доступные через /userinfo
+// для каждой стандартной области доступа (OpenID Connect Core, 5.4)
+var scopeClaims = map[string][]string{
+	"profile": {
+		"name", "family_name", "given_name", "middle_name", "nickname",
+		"preferred_username", "profile", "picture", "website", "gender",
+		"birthdate", "zoneinfo", "locale", "updated_at",
+	},
+	"email": {"email", "email_verified"},
+	"phone": {"phone_number", "phone_number_verified"},
+	"address": {"address"},
+}
+
+// ID токены подписываются только асимметричным ключом: подпись секретом
+// сервиса клиент проверить не может, а раскрывать секрет ему нельзя.
+// С симметричным активным ключом OpenID Connect отключен. Без jwt.issuer
+// он также отключен: iss обязателен в ID токене, а адреса конечных точек
+// в метаданных строятся от него
+func (j *Jwt) oidcEnabled() bool {
+	return !j.keys.Active().Symmetric() && j.claims.Issuer != ""
+}
+
+// Утверждения ID токена (OpenID Connect Core, 2)
+type IdTokenClaims struct {
+	*jwt.RegisteredClaims
+
+	AuthTime	*jwt.NumericDate	`json:"auth_time,omitempty"`
+	Nonce		string				`json:"nonce,omitempty"`
+	AtHash		string				`json:"at_hash,omitempty"`
+	Azp			string				`json:"azp,omitempty"`
+}
+
+// Выпускает ID токен для пары токенов, если среди областей доступа
+// есть openid. Иначе возвращает пустую строку
+func (j *Jwt) IdToken(
+	ctx context.Context,
+	client *entity.Client,
+	uuid string,
+	nonce string,
+	authTime time.Time,
+	tokens *dto.Tokens,
+) (string, error) {
+
+	if !containsScope(parseScope(tokens.Scope), ScopeOpenId) {
+		return "", nil
+	}
+
+	key := j.keys.Active()
+
+	// Активный ключ могли заменить на симметричный после выдачи пары
+	if key.Symmetric() {
+
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Error("id token requires an asymmetric signing key")
+
+		return "", errors.Internal.New("id token requires an asymmetric signing key")
+	}
+
+	now := time.Now()
+
+	claims := &IdTokenClaims{
+		RegisteredClaims: &jwt.RegisteredClaims{
+			Issuer: j.claims.Issuer,
+			Subject: uuid,
+			Audience: jwt.ClaimStrings{client.Id},
+			ExpiresAt: j.expiresAt(j.accessExpireFor(client)),
+			IssuedAt: jwt.NewNumericDate(now),
+		},
+		Nonce: nonce,
+		AtHash: atHash(key.Method(), tokens.Access),
+		Azp: client.Id,
+	}
+
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.Id()
+
+	result, err := token.SignedString(key.signKey)
+	if err != nil {
+
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Errorf("sign id token: %s", err)
+
+		return "", errors.Internal.New("sign id token").Wrap(err)
+	}
+
+	return result, nil
+}
+
+// Метаданные провайдера. Адреса конечных точек строятся от издателя,
+// поэтому jwt.issuer должен совпадать с внешним адресом API.
+// С симметричным активным ключом возвращает NotFound
+func (j *Jwt) OpenIdConfiguration(
+	ctx context.Context,
+) (*dto.OpenIdConfiguration, error) {
+
+	if !j.oidcEnabled() {
+		return nil, errors.NotFound.New("openid connect is disabled")
+	}
+
+	issuer := strings.TrimSuffix(j.claims.Issuer, "/")
+
+	scopes := []string{ScopeOpenId}
+	claims := []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce"}
+
+	for _, scope := range []string{"profile", "email", "phone", "address"} {
+		scopes = append(scopes, scope)
+		claims = append(claims, scopeClaims[scope]...)
+	}
+
+	return &dto.OpenIdConfiguration{
+		Issuer: j.claims.Issuer,
+		AuthorizationEndpoint: issuer + "/authorize",
+		TokenEndpoint: issuer + "/token",
+		UserinfoEndpoint: issuer + "/userinfo",
+		JwksUri: issuer + "/.well-known/jwks.json",
+		RevocationEndpoint: issuer + "/revoke",
+		IntrospectionEndpoint: issuer + "/introspect",
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			entity.GrantAuthorizationCode,
+			entity.GrantClientCredentials,
+			entity.GrantTokenExchange,
+		},
+		SubjectTypesSupported: []string{"public"},
+		IdTokenSigningAlgValuesSupported: []string{j.keys.Active().Method().Alg()},
+		TokenEndpointAuthMethodsSupported: []string{
+			"client_secret_basic",
+			"client_secret_post",
+			"none",
+		},
+		CodeChallengeMethodsSupported: []string{entity.CodeChallengeS256},
+		ScopesSupported: scopes,
+		ClaimsSupported: claims,
+	}, nil
+}
+
+// Левая половина хеша access токена (OpenID Connect Core, 3.1.3.6).
+// Хеш-функция соответствует алгоритму подписи, для EdDSA - SHA-512
+func atHash(method jwt.SigningMethod, access string) string {
+
+	hash := crypto.SHA512
+
+	switch {
+		case strings.HasSuffix(method.Alg(), "256"):
+			hash = crypto.SHA256
+
+		case strings.HasSuffix(method.Alg(), "384"):
+			hash = crypto.SHA384
+	}
+
+	h := hash.New()
+	h.Write([]byte(access))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum) / 2])
+}
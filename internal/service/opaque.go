@@ -0,0 +1,123 @@
+package service
+
+import (
+	"time"
+	"context"
+	"strings"
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/reqid"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Форматы access токенов
+const (
+	AccessTokenJwt		= "jwt"
+
+	// Случайная строка без утверждений. Утверждения хранятся в БД,
+	// сервисы получают их через интроспекцию
+	AccessTokenOpaque	= "opaque"
+)
+
+// Хранилище непрозрачных access токенов (по SHA-256 токена)
+type OpaqueTokenRepository interface {
+	Save(ctx context.Context, token *entity.OpaqueToken) error
+	GetByLookup(ctx context.Context, lookup string) (*entity.OpaqueToken, error)
+}
+
+// Формат access токенов клиента (пустой - формат из конфигурации)
+func (j *Jwt) accessFormatFor(client *entity.Client) string {
+
+	if client == nil || client.AccessTokenFormat == "" {
+		return j.accessFormat
+	}
+
+	return client.AccessTokenFormat
+}
+
+// Выпускает непрозрачный токен и сохраняет его утверждения. Связь
+// с refresh токеном (r_id) хранится только в БД. Запись хранится
+// до истечения refresh токена, иначе истекший access токен нельзя
+// было бы обменять на новую пару
+func (j *Jwt) createOpaque(
+	ctx context.Context,
+	claims *AccessClaims,
+	client *entity.Client,
+) (string, error) {
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Internal.New("marshal claims").Wrap(err)
+	}
+
+	token, err := j.generateRandomToken(ctx, j.opaqueLen)
+	if err != nil {
+		return "", err
+	}
+
+	expireAt := claims.ExpiresAt.Add(time.Second * j.claims.Leeway)
+
+	if claims.RefreshId != "" {
+		expireAt = time.Now().Add(time.Minute * j.refreshExpireFor(client))
+	}
+
+	err = j.opaque.Save(ctx, &entity.OpaqueToken{
+		Lookup: lookupHash(token),
+		Claims: data,
+		ExpireAt: expireAt,
+	})
+	if err != nil {
+		return "", errors.Internal.New("save opaque token").Wrap(err)
+	}
+
+	return token, nil
+}
+
+// Находит утверждения непрозрачного токена. Как и для jwt,
+// истекший токен не считается ошибкой
+func (j *Jwt) parseOpaque(
+	ctx context.Context,
+	token string,
+) (*AccessClaims, bool, error) {
+
+	stored, err := j.opaque.GetByLookup(ctx, lookupHash(token))
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return nil, false, errors.InvalidToken.New("unknown token").Wrap(err)
+		}
+
+		return nil, false, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	claims := &AccessClaims{RegisteredClaims: &jwt.RegisteredClaims{}}
+
+	if err := json.Unmarshal(stored.Claims, claims); err != nil {
+
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+		}).Errorf("unmarshal opaque claims: %s", err)
+
+		return nil, false, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, false, errors.InvalidToken.New("missing exp")
+	}
+
+	leeway := time.Second * j.claims.Leeway
+	isExpired := !time.Now().Before(claims.ExpiresAt.Add(leeway))
+
+	return claims, isExpired, nil
+}
+
+// Jwt в компактной форме состоит из трех частей, разделенных точками.
+// Непрозрачный токен точек не содержит
+func isOpaque(token string) bool {
+	return !strings.Contains(token, ".")
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Источник ролей, разрешений и допустимых областей доступа пользователя
+type ClaimsProvider interface {
+	Claims(ctx context.Context, uuid string) (*entity.UserClaims, error)
+}
+
+// Определяет области доступа сессии и возвращает полномочия пользователя.
+// При входе доступны все разрешенные пользователю и клиенту области,
+// при обновлении - только области сессии, которые все еще разрешены.
+// Сессии, созданные до появления областей доступа (Scopes == nil),
+// при обновлении получают те же области, что и при входе.
+// Область openid доступна, только если включен OpenID Connect.
+// Запрошенные области могут лишь сузить доступные
+func (j *Jwt) grantScopes(
+	ctx context.Context,
+	newSession bool,
+	session *entity.RefreshToken,
+	client *entity.Client,
+	requested []string,
+) (*entity.UserClaims, error) {
+
+	user, err := j.claimsProvider.Claims(ctx, session.Uuid)
+	if err != nil {
+
+		j.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"uuid": session.Uuid,
+		}).Errorf("get user claims: %s", err)
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	available := clientScopes(client, user.Scopes)
+	if !newSession && session.Scopes != nil {
+		available = intersectScopes(session.Scopes, available)
+	}
+
+	if !j.oidcEnabled() {
+		available = withoutScope(available, ScopeOpenId)
+	}
+
+	if len(requested) == 0 {
+		session.Scopes = available
+		return user, nil
+	}
+
+	for _, scope := range requested {
+		if !containsScope(available, scope) {
+			return nil, errors.InvalidScope.New("scope not allowed: " + scope)
+		}
+	}
+
+	session.Scopes = requested
+
+	return user, nil
+}
+
+// Разбирает список областей доступа, разделенных пробелами (RFC 6749)
+func parseScope(scope string) []string {
+
+	var scopes []string
+
+	for _, s := range strings.Fields(scope) {
+		if !containsScope(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+func formatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func intersectScopes(a, b []string) []string {
+
+	var result []string
+
+	for _, s := range a {
+		if containsScope(b, s) {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+func withoutScope(scopes []string, scope string) []string {
+
+	var result []string
+
+	for _, s := range scopes {
+		if s != scope {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+func containsScope(scopes []string, scope string) bool {
+
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
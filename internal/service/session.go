@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/reqid"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Возвращает активные сессии владельца access токена.
+// Идентификатор сессии - идентификатор семейства refresh токенов
+func (j *Jwt) Sessions(
+	ctx context.Context,
+	access string,
+	presented *dto.Confirmation,
+) ([]dto.Session, error) {
+
+	claims, err := j.VerifyAccess(ctx, access, presented)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := j.activeSessions(ctx, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]dto.Session, 0, len(tokens))
+
+	for _, t := range tokens {
+		sessions = append(sessions, dto.Session{
+			Id: t.FamilyId,
+			UserAgent: t.UserAgent,
+			ClientIp: t.ClientIp,
+			DeviceName: t.DeviceName,
+			CreatedAt: t.CreatedAt,
+			LastRefreshedAt: t.LastRefreshedAt,
+			ExpireAt: t.ExpireAt,
+			Scopes: t.Scopes,
+			Current: t.Id == claims.RefreshId,
+		})
+	}
+
+	return sessions, nil
+}
+
+// Завершает сессию владельца access токена
+func (j *Jwt) RevokeSession(
+	ctx context.Context,
+	access string,
+	presented *dto.Confirmation,
+	sessionId string,
+) error {
+
+	claims, err := j.VerifyAccess(ctx, access, presented)
+	if err != nil {
+		return err
+	}
+
+	// Сессия, которой принадлежит access токен запроса
+	var current *entity.RefreshToken
+
+	if claims.RefreshId != "" {
+		current, err = j.repo.GetById(ctx, claims.RefreshId)
+		if err != nil && !errutil.Has(err, errors.NotFound) {
+			return errors.Internal.NewDefault().Wrap(err)
+		}
+	}
+
+	// Семейство удаляется только вместе с uuid владельца:
+	// чужую сессию завершить нельзя
+	err = j.repo.DeleteUserFamily(ctx, claims.Subject, sessionId)
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return errors.NotFound.New("session not found")
+		}
+
+		return errors.Internal.NewDefault().Wrap(err)
+	}
+
+	j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"uuid": claims.Subject,
+		"family_id": sessionId,
+	}).Info("session revoked")
+
+	// При завершении текущей сессии отзывается и access токен запроса
+	if current != nil && current.FamilyId == sessionId {
+		return j.denyAccess(ctx, claims)
+	}
+
+	return nil
+}
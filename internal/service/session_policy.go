@@ -0,0 +1,157 @@
+package service
+
+import (
+	"time"
+	"context"
+
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/reqid"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Действие при достижении лимита сессий пользователя
+const (
+	EvictOldest	= "revoke_oldest"	// завершить самую старую сессию
+	RejectNew	= "reject"			// отклонить вход
+)
+
+// Ограничения сессий пользователя
+type SessionPolicy struct {
+	MaxSessions	int		// 0 - без ограничений
+	Eviction	string	// EvictOldest или RejectNew
+
+	// Абсолютный срок сессии с момента входа (0 - без ограничения)
+	MaxAge		time.Duration
+
+	// Допустимое время между обновлениями пары (0 - без ограничения)
+	IdleTimeout	time.Duration
+}
+
+// Блокировка, сериализующая создание сессий одного пользователя
+type SessionLocker interface {
+	Lock(ctx context.Context, uuid string) (func(), error)
+}
+
+// Освобождает место для новой сессии пользователя согласно политике.
+// Вызывается под блокировкой пользователя, поэтому одновременные входы
+// не могут превысить лимит
+func (j *Jwt) enforceSessionLimit(ctx context.Context, uuid string) error {
+
+	sessions, err := j.activeSessions(ctx, uuid)
+	if err != nil {
+		return err
+	}
+
+	excess := len(sessions) - j.sessions.MaxSessions + 1
+	if excess <= 0 {
+		return nil
+	}
+
+	logger := j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"uuid": uuid,
+		"sessions": len(sessions),
+	})
+
+	if j.sessions.Eviction == RejectNew {
+		logger.Warn("session limit reached, sign-in rejected")
+
+		return errors.SessionLimit.NewDefault()
+	}
+
+	// Сессии упорядочены по времени входа: завершаются самые старые
+	for _, session := range sessions[:excess] {
+
+		err := j.repo.DeleteUserFamily(ctx, uuid, session.FamilyId)
+		if err != nil && !errutil.Has(err, errors.NotFound) {
+			return errors.Internal.NewDefault().Wrap(err)
+		}
+
+		logger.WithFields(map[string]any{
+			"family_id": session.FamilyId,
+		}).Info("session limit reached, oldest session revoked")
+	}
+
+	return nil
+}
+
+// Действующие сессии пользователя, упорядоченные по времени входа.
+// Сессии, превысившие абсолютный срок или время бездействия, хранятся
+// до истечения refresh токена, но не учитываются ни в лимите, ни в списке
+func (j *Jwt) activeSessions(
+	ctx context.Context,
+	uuid string,
+) ([]*entity.RefreshToken, error) {
+
+	now := time.Now()
+
+	var idleSince time.Time
+	if j.sessions.IdleTimeout > 0 {
+		idleSince = now.Add(-time.Minute * j.sessions.IdleTimeout)
+	}
+
+	tokens, err := j.repo.GetActiveByUuid(ctx, uuid, idleSince)
+	if err != nil {
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	active := make([]*entity.RefreshToken, 0, len(tokens))
+
+	for _, token := range tokens {
+		if j.sessionExpiry(token, now) == "" {
+			active = append(active, token)
+		}
+	}
+
+	return active, nil
+}
+
+// Проверяет, что сессия не превысила абсолютный срок
+// и время бездействия
+func (j *Jwt) checkSessionExpiry(
+	ctx context.Context,
+	session *entity.RefreshToken,
+) error {
+
+	reason := j.sessionExpiry(session, time.Now())
+	if reason == "" {
+		return nil
+	}
+
+	j.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"family_id": session.FamilyId,
+	}).Info(reason)
+
+	return errors.SessionExpired.New(reason)
+}
+
+// Причина завершения сессии на момент now (пустая - сессия действует)
+func (j *Jwt) sessionExpiry(session *entity.RefreshToken, now time.Time) string {
+
+	if !session.SessionExpireAt.IsZero() && !now.Before(session.SessionExpireAt) {
+		return "session max age exceeded"
+	}
+
+	idleTimeout := time.Minute * j.sessions.IdleTimeout
+
+	if idleTimeout > 0 && !session.LastRefreshedAt.IsZero() &&
+		!now.Before(session.LastRefreshedAt.Add(idleTimeout)) {
+
+		return "session idle timeout exceeded"
+	}
+
+	return ""
+}
+
+// Абсолютный срок новой сессии
+func (j *Jwt) sessionExpireAt(createdAt time.Time) time.Time {
+
+	if j.sessions.MaxAge <= 0 {
+		return time.Time{}
+	}
+
+	return createdAt.Add(time.Minute * j.sessions.MaxAge)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"time"
+	"context"
+	"testing"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+)
+
+// Сессии, превысившие время бездействия или абсолютный срок, не мешают
+// входу при политике reject и не показываются в списке сессий
+func TestDeadSessionsNotCounted(t *testing.T) {
+
+	cases := map[string]func(session *entity.RefreshToken){
+		"idle": func(session *entity.RefreshToken) {
+			session.LastRefreshedAt = time.Now().Add(-time.Hour)
+		},
+		"max age": func(session *entity.RefreshToken) {
+			session.SessionExpireAt = time.Now().Add(-time.Minute)
+		},
+	}
+
+	for name, expire := range cases {
+		t.Run(name, func(t *testing.T) {
+
+			ctx := context.Background()
+			j := newTestJwt(t, nil)
+
+			j.sessions = SessionPolicy{
+				MaxSessions: 1,
+				Eviction: RejectNew,
+				MaxAge: 60,
+				IdleTimeout: 30,
+			}
+
+			_, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stale := j.tokens.familyId()
+
+			j.tokens.mu.Lock()
+			for _, token := range j.tokens.tokens {
+				expire(token)
+			}
+			j.tokens.mu.Unlock()
+
+			tokens, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+			if err != nil {
+				t.Fatalf("sign-in rejected by dead session: %v", err)
+			}
+
+			sessions, err := j.Sessions(ctx, tokens.Access, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(sessions) != 1 || sessions[0].Id == stale {
+				t.Fatalf("sessions = %+v, want only the new one", sessions)
+			}
+		})
+	}
+}
+
+// Живые сессии по-прежнему ограничивают вход
+func TestSessionLimitRejects(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	j.sessions = SessionPolicy{MaxSessions: 1, Eviction: RejectNew, IdleTimeout: 30}
+
+	_, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err == nil {
+		t.Fatal("second session allowed over the limit")
+	}
+}
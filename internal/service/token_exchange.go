@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Тип токенов, которые принимаются и выдаются при обмене (RFC 8693, 3)
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// Действующая сторона (RFC 8693, 4.1). Вложенное утверждение act
+// содержит предыдущие стороны цепочки делегирования
+type Actor struct {
+	Sub			string	`json:"sub"`
+	ClientId	string	`json:"client_id,omitempty"`
+	Act			*Actor	`json:"act,omitempty"`
+}
+
+// Обмен токенов (RFC 8693): сервис, действующий от имени пользователя,
+// получает вместо его токена токен для другой аудитории с суженными
+// областями доступа
+type TokenExchange struct {
+	jwt *Jwt
+	rules []entity.ExchangeRule
+
+	logger log.Logger
+}
+
+func NewTokenExchange(
+	jwt *Jwt,
+	rules []entity.ExchangeRule,
+	logger log.Logger,
+) *TokenExchange {
+	return &TokenExchange{
+		jwt: jwt,
+		rules: rules,
+		logger: logger.WithFields(map[string]any{
+			"unit": "token_exchange",
+		}),
+	}
+}
+
+// Выдает токен для аудитории request.Audience по subject токену,
+// выданному этим сервисом. С actor токеном сторона, от которой он
+// выдан, добавляется в утверждение act (делегирование), без него
+// токен выдается от имени пользователя (имперсонация)
+func (t *TokenExchange) Exchange(
+	ctx context.Context,
+	client *entity.Client,
+	request *dto.TokenRequest,
+	cnf *dto.Confirmation,
+) (*dto.TokenResponse, error) {
+
+	if request.SubjectToken == "" || request.Audience == "" {
+		return nil, errors.InvalidRequest.New(
+			"subject_token and audience are required",
+		)
+	}
+
+	if request.SubjectTokenType != TokenTypeAccessToken {
+		return nil, errors.InvalidRequest.New(
+			"unsupported subject_token_type: " + request.SubjectTokenType,
+		)
+	}
+
+	rule := t.rule(client.Id, request.Audience)
+	if rule == nil {
+		return nil, errors.InvalidTarget.New(
+			"audience not allowed: " + request.Audience,
+		)
+	}
+
+	subject, err := t.jwt.verifyIssued(ctx, request.SubjectToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Привязанный к ключу subject токен обменивает только владелец ключа:
+	// иначе обмен снимал бы привязку с перехваченного токена
+	if err := checkConfirmation(subject, cnf); err != nil {
+
+		t.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"sub": subject.Subject,
+			"client_id": client.Id,
+		}).Warnf("exchange of bound subject token: %s", err)
+
+		return nil, err
+	}
+
+	act, err := t.actor(ctx, client, rule, subject, request)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes, err := exchangeScopes(subject, rule, parseScope(request.Scope))
+	if err != nil {
+		return nil, err
+	}
+
+	session := &entity.RefreshToken{
+		Uuid: subject.Subject,
+		ClientId: client.Id,
+		Scopes: scopes,
+	}
+
+	session.Jkt, session.X5t = binding(cnf)
+
+	user := &entity.UserClaims{
+		Roles: subject.Roles,
+		Permissions: subject.Permissions,
+	}
+
+	// Аудитория токена - только целевой сервис: сам сервис его не примет
+	access, err := t.jwt.createAccess(
+		ctx,
+		session,
+		client,
+		[]string{request.Audience},
+		"",
+		user,
+		act,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	t.logger.WithFields(map[string]any{
+		"req_id": reqid.FromContext(ctx),
+		"sub": subject.Subject,
+		"client_id": client.Id,
+		"audience": request.Audience,
+		"delegation": act != nil,
+	}).Info("token exchange")
+
+	return &dto.TokenResponse{
+		AccessToken: access,
+		IssuedTokenType: TokenTypeAccessToken,
+		TokenType: "Bearer",
+		ExpiresIn: t.jwt.expiresIn(client),
+		Scope: formatScope(scopes),
+	}, nil
+}
+
+// Утверждение act нового токена. Actor токен должен быть выдан
+// клиенту, выполняющему обмен, а прежняя цепочка subject токена
+// становится вложенной
+func (t *TokenExchange) actor(
+	ctx context.Context,
+	client *entity.Client,
+	rule *entity.ExchangeRule,
+	subject *AccessClaims,
+	request *dto.TokenRequest,
+) (*Actor, error) {
+
+	if request.ActorToken == "" {
+
+		if !rule.Impersonation {
+			return nil, errors.InvalidRequest.New("actor_token is required")
+		}
+
+		return subject.Act, nil
+	}
+
+	if request.ActorTokenType != TokenTypeAccessToken {
+		return nil, errors.InvalidRequest.New(
+			"unsupported actor_token_type: " + request.ActorTokenType,
+		)
+	}
+
+	actor, err := t.jwt.verifyIssued(ctx, request.ActorToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if actor.ClientId != client.Id {
+		return nil, errors.InvalidGrant.New(
+			"actor token was not issued to the client",
+		)
+	}
+
+	return &Actor{
+		Sub: actor.Subject,
+		ClientId: actor.ClientId,
+		Act: subject.Act,
+	}, nil
+}
+
+// Правило, разрешающее клиенту обмен для аудитории
+func (t *TokenExchange) rule(
+	clientId string,
+	audience string,
+) *entity.ExchangeRule {
+
+	for i := range t.rules {
+		rule := &t.rules[i]
+
+		if rule.ClientId == clientId && containsScope(rule.Audiences, audience) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// Области доступа нового токена: не шире областей subject токена
+// и ограничения правила. Запрошенные области могут лишь сузить их
+func exchangeScopes(
+	subject *AccessClaims,
+	rule *entity.ExchangeRule,
+	requested []string,
+) ([]string, error) {
+
+	available := parseScope(subject.Scope)
+	if len(rule.Scopes) > 0 {
+		available = intersectScopes(available, rule.Scopes)
+	}
+
+	if len(requested) == 0 {
+		return available, nil
+	}
+
+	for _, scope := range requested {
+		if !containsScope(available, scope) {
+			return nil, errors.InvalidScope.New("scope not allowed: " + scope)
+		}
+	}
+
+	return requested, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+func tokenAudience(t *testing.T, token string) []string {
+
+	t.Helper()
+
+	claims := &jwt.RegisteredClaims{}
+
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+
+	return claims.Audience
+}
+
+// Токен, полученный обменом, содержит только запрошенную аудиторию:
+// сам сервис его как собственный не принимает, но интроспекция
+// и дальнейший обмен по цепочке работают
+func TestExchangeAudience(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	orders := &entity.Client{
+		Id: "orders-service",
+		GrantTypes: []string{entity.GrantTokenExchange},
+		Audience: []string{"orders-api"},
+	}
+
+	billing := &entity.Client{
+		Id: "billing-service",
+		GrantTypes: []string{entity.GrantTokenExchange},
+	}
+
+	exchange := NewTokenExchange(j.Jwt, []entity.ExchangeRule{
+		{ClientId: orders.Id, Audiences: []string{"billing-service"}, Impersonation: true},
+		{ClientId: billing.Id, Audiences: []string{"ledger-service"}, Impersonation: true},
+	}, log.NewLogrusLogger())
+
+	user, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchanged, err := exchange.Exchange(ctx, orders, &dto.TokenRequest{
+		SubjectToken: user.Access,
+		SubjectTokenType: TokenTypeAccessToken,
+		Audience: "billing-service",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aud := tokenAudience(t, exchanged.AccessToken)
+	if len(aud) != 1 || aud[0] != "billing-service" {
+		t.Fatalf("aud = %v, want [billing-service]", aud)
+	}
+
+	if _, err := j.VerifyAccess(ctx, exchanged.AccessToken, nil); err == nil {
+		t.Fatal("token for another audience accepted by the service")
+	}
+
+	info, err := j.Introspect(ctx, exchanged.AccessToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !info.Active {
+		t.Fatal("exchanged token is inactive on introspection")
+	}
+
+	chained, err := exchange.Exchange(ctx, billing, &dto.TokenRequest{
+		SubjectToken: exchanged.AccessToken,
+		SubjectTokenType: TokenTypeAccessToken,
+		Audience: "ledger-service",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aud = tokenAudience(t, chained.AccessToken)
+	if len(aud) != 1 || aud[0] != "ledger-service" {
+		t.Fatalf("aud = %v, want [ledger-service]", aud)
+	}
+}
+
+// Subject токен, привязанный к ключу, обменивается только с подтверждением
+// владения тем же ключом: перехваченный токен нельзя отвязать обменом
+func TestExchangeBoundSubject(t *testing.T) {
+
+	ctx := context.Background()
+	j := newTestJwt(t, nil)
+
+	orders := &entity.Client{
+		Id: "orders-service",
+		GrantTypes: []string{entity.GrantTokenExchange},
+	}
+
+	exchange := NewTokenExchange(j.Jwt, []entity.ExchangeRule{
+		{ClientId: orders.Id, Audiences: []string{"billing-service"}, Impersonation: true},
+	}, log.NewLogrusLogger())
+
+	bound := &dto.Confirmation{Jkt: "client-key"}
+
+	user, err := j.CreateTokens(ctx, "user-1", &dto.SessionMeta{}, "", testClient, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := &dto.TokenRequest{
+		SubjectToken: user.Access,
+		SubjectTokenType: TokenTypeAccessToken,
+		Audience: "billing-service",
+	}
+
+	rejected := []*dto.Confirmation{
+		nil,
+		{Jkt: "other-key"},
+		{X5tS256: "cert-thumbprint"},
+	}
+
+	for _, cnf := range rejected {
+		if _, err := exchange.Exchange(ctx, orders, request, cnf); err == nil {
+			t.Fatalf("bound subject token exchanged with %+v", cnf)
+		}
+	}
+
+	exchanged, err := exchange.Exchange(ctx, orders, request, bound)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exchanged.AccessToken == "" {
+		t.Fatal("no access token issued")
+	}
+}
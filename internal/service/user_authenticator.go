@@ -0,0 +1,55 @@
+package service
+
+import (
+	"net"
+	"context"
+	"net/http"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/errors"
+	"github.com/amaretur/auth-service/internal/validator"
+
+	"github.com/amaretur/auth-service/pkg/clientip"
+)
+
+// Определяет пользователя по заголовку, который выставляет прокси,
+// выполнивший вход (например, страница входа за oauth2-proxy).
+// Заголовок принимается только от доверенных прокси: иначе любой клиент,
+// обратившийся к сервису напрямую, мог бы войти под чужим uuid
+type HeaderAuthenticator struct {
+	header	string
+	trusted	[]*net.IPNet
+}
+
+func NewHeaderAuthenticator(header string, trusted []*net.IPNet) *HeaderAuthenticator {
+	return &HeaderAuthenticator{
+		header: header,
+		trusted: trusted,
+	}
+}
+
+func (h *HeaderAuthenticator) Authenticate(
+	ctx context.Context,
+	request *dto.UserAuthRequest,
+) (string, error) {
+
+	uuid := http.Header(request.Headers).Get(h.header)
+	if uuid == "" {
+		return "", errors.LoginRequired.NewDefault()
+	}
+
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		ip = request.RemoteAddr
+	}
+
+	if !clientip.IsTrusted(ip, h.trusted) {
+		return "", errors.LoginRequired.New("user header from untrusted address: " + ip)
+	}
+
+	if err := validator.ValidateUuid(uuid); err != nil {
+		return "", errors.LoginRequired.New("invalid user id").Wrap(err)
+	}
+
+	return uuid, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/reqid"
+)
+
+// Источник профилей пользователей для /userinfo.
+// Для неизвестного пользователя возвращает пустой профиль
+type ProfileSource interface {
+	Profile(ctx context.Context, uuid string) (map[string]any, error)
+}
+
+// Сведения о пользователе по access токену (OpenID Connect Core, 5.3)
+type UserInfo struct {
+	jwt *Jwt
+	profiles ProfileSource
+
+	logger log.Logger
+}
+
+func NewUserInfo(
+	jwt *Jwt,
+	profiles ProfileSource,
+	logger log.Logger,
+) *UserInfo {
+	return &UserInfo{
+		jwt: jwt,
+		profiles: profiles,
+		logger: logger.WithFields(map[string]any{
+			"unit": "userinfo",
+		}),
+	}
+}
+
+// Возвращает утверждения профиля, разрешенные областями доступа токена
+func (u *UserInfo) UserInfo(
+	ctx context.Context,
+	access string,
+	presented *dto.Confirmation,
+) (map[string]any, error) {
+
+	claims, err := u.jwt.VerifyAccess(ctx, access, presented)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := parseScope(claims.Scope)
+
+	if !containsScope(scopes, ScopeOpenId) {
+		return nil, errors.InvalidScope.New("openid scope is required")
+	}
+
+	profile, err := u.profiles.Profile(ctx, claims.Subject)
+	if err != nil {
+
+		u.logger.WithFields(map[string]any{
+			"req_id": reqid.FromContext(ctx),
+			"uuid": claims.Subject,
+		}).Errorf("get profile: %s", err)
+
+		return nil, errors.Internal.NewDefault().Wrap(err)
+	}
+
+	result := map[string]any{
+		"sub": claims.Subject,
+	}
+
+	for _, scope := range scopes {
+		for _, name := range scopeClaims[scope] {
+			if value, ok := profile[name]; ok {
+				result[name] = value
+			}
+		}
+	}
+
+	return result, nil
+}
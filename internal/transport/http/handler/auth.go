@@ -15,8 +15,24 @@ import (
 )
 
 type Usecase interface {
-	SignIn(ctx context.Context, uuid string) (*dto.Tokens, error)
-	Refresh(ctx context.Context, tokens *dto.Tokens) (*dto.Tokens, error)
+	SignIn(
+		ctx context.Context,
+		credentials *dto.ClientCredentials,
+		uuid string,
+		meta *dto.SessionMeta,
+		scope string,
+		proof *dto.DPoPProof,
+	) (*dto.Tokens, error)
+
+	Refresh(
+		ctx context.Context,
+		credentials *dto.ClientCredentials,
+		tokens *dto.Tokens,
+		proof *dto.DPoPProof,
+	) (*dto.Tokens, error)
+
+	Logout(ctx context.Context, tokens *dto.Tokens) error
+	LogoutAll(ctx context.Context, tokens *dto.Tokens) error
 }
 
 type Auth struct {
@@ -35,6 +51,8 @@ func (a *Auth) Init(router *mux.Router) {
 
 	router.HandleFunc("/sign-in", a.Auth).Methods("POST")
 	router.HandleFunc("/refresh", a.Refresh).Methods("POST")
+	router.HandleFunc("/logout", a.Logout).Methods("POST")
+	router.HandleFunc("/logout-all", a.LogoutAll).Methods("POST")
 }
 
 func (a *Auth) Auth(w http.ResponseWriter, r *http.Request) {
@@ -49,7 +67,28 @@ func (a *Auth) Auth(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
 	defer cancel()
 
-	tokens, err := a.usecase.SignIn(ctx, uuid)
+	meta := &dto.SessionMeta{
+		UserAgent: r.UserAgent(),
+		ClientIp: clientIp(r),
+		DeviceName: r.URL.Query().Get("device"),
+	}
+
+	scope := r.URL.Query().Get("scope")
+
+	proof, ok := dpopProof(r)
+	if !ok {
+		Error(w, http.StatusBadRequest, "multiple dpop proofs")
+		return
+	}
+
+	tokens, err := a.usecase.SignIn(
+		ctx,
+		clientCredentials(r),
+		uuid,
+		meta,
+		scope,
+		proof,
+	)
 	if err != nil {
 
 		code, msg := errToHttpResp(err, defErrHttpMapper)
@@ -73,10 +112,18 @@ func (a *Auth) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	proof, ok := dpopProof(r)
+	if !ok {
+		Error(w, http.StatusBadRequest, "multiple dpop proofs")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
 	defer cancel()
 
-	tokens, err := a.usecase.Refresh(ctx, &data)
+	// Тело запроса уже прочитано, поэтому учетные данные клиента
+	// передаются только в заголовке Authorization
+	tokens, err := a.usecase.Refresh(ctx, clientCredentials(r), &data, proof)
 	if err != nil {
 
 		code, msg := errToHttpResp(err, defErrHttpMapper)
@@ -90,3 +137,55 @@ func (a *Auth) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	Response(w, tokens)
 }
+
+func (a *Auth) Logout(w http.ResponseWriter, r *http.Request) {
+
+	var data dto.Tokens
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		Error(w, http.StatusBadRequest, "invalid json structure")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	if err := a.usecase.Logout(ctx, &data); err != nil {
+
+		code, msg := errToHttpResp(err, defErrHttpMapper)
+
+		logger(r, a.logger, map[string]any{"code": code, "body": msg}).
+			Warn(err)
+
+		Error(w, code, msg)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Auth) LogoutAll(w http.ResponseWriter, r *http.Request) {
+
+	var data dto.Tokens
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		Error(w, http.StatusBadRequest, "invalid json structure")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	if err := a.usecase.LogoutAll(ctx, &data); err != nil {
+
+		code, msg := errToHttpResp(err, defErrHttpMapper)
+
+		logger(r, a.logger, map[string]any{"code": code, "body": msg}).
+			Warn(err)
+
+		Error(w, code, msg)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
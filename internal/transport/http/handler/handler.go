@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"net"
+
 	"github.com/gorilla/mux"
 
 	"github.com/amaretur/auth-service/internal/transport/http/middleware"
@@ -14,12 +16,15 @@ type Handler struct {
 	router *mux.Router
 }
 
-func NewHandler(pathPrefix string) *Handler {
+// trustedProxies - прокси, которым разрешено передавать адрес
+// клиента в X-Forwarded-For
+func NewHandler(pathPrefix string, trustedProxies []*net.IPNet) *Handler {
 
 	r := mux.NewRouter().StrictSlash(true).PathPrefix(pathPrefix).Subrouter()
 
 	r.Use(middleware.ApplicationJson)
 	r.Use(middleware.ReqId)
+	r.Use(middleware.ClientIp(trustedProxies))
 
 	return &Handler{
 		router : r,
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"fmt"
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/amaretur/auth-service/internal/dto"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Время кеширования набора ключей клиентами (сек.)
+const jwksMaxAge = 300
+
+type KeysUsecase interface {
+	Jwks(ctx context.Context) *dto.Jwks
+}
+
+type Keys struct {
+	usecase	KeysUsecase
+	logger	log.Logger
+}
+
+func NewKeys(usecase KeysUsecase, logger log.Logger) *Keys {
+	return &Keys{
+		usecase: usecase,
+		logger: logger,
+	}
+}
+
+func (k *Keys) Init(router *mux.Router) {
+
+	router.HandleFunc("/.well-known/jwks.json", k.Jwks).Methods("GET")
+}
+
+func (k *Keys) Jwks(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set(
+		"Cache-Control",
+		fmt.Sprintf("public, max-age=%d, must-revalidate", jwksMaxAge),
+	)
+
+	Response(w, k.usecase.Jwks(r.Context()))
+}
@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"time"
+	"context"
+	"net/http"
+	"encoding/json"
+
+	"github.com/gorilla/mux"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/errors"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+type OAuthUsecase interface {
+	Introspect(
+		ctx context.Context,
+		credentials *dto.ClientCredentials,
+		token string,
+		hint string,
+	) (*dto.Introspection, error)
+
+	Revoke(
+		ctx context.Context,
+		credentials *dto.ClientCredentials,
+		token string,
+		hint string,
+	) error
+
+	Token(
+		ctx context.Context,
+		credentials *dto.ClientCredentials,
+		request *dto.TokenRequest,
+	) (*dto.TokenResponse, error)
+
+	Authorize(
+		ctx context.Context,
+		request *dto.AuthorizeRequest,
+		user *dto.UserAuthRequest,
+	) (*dto.AuthorizeResult, error)
+}
+
+// Ошибка конечной точки /token (RFC 6749, 5.2)
+type oauthError struct {
+	status	int
+	code	string
+}
+
+var tokenErrors = map[uint32]oauthError{
+	errors.Unauthorized.TypeId: {http.StatusUnauthorized, "invalid_client"},
+	errors.UnauthorizedClient.TypeId: {http.StatusBadRequest, "unauthorized_client"},
+	errors.UnsupportedGrant.TypeId: {http.StatusBadRequest, "unsupported_grant_type"},
+	errors.InvalidScope.TypeId: {http.StatusBadRequest, "invalid_scope"},
+	errors.InvalidToken.TypeId: {http.StatusBadRequest, "invalid_grant"},
+	errors.InvalidGrant.TypeId: {http.StatusBadRequest, "invalid_grant"},
+	errors.InvalidRequest.TypeId: {http.StatusBadRequest, "invalid_request"},
+	errors.InvalidTarget.TypeId: {http.StatusBadRequest, "invalid_target"},
+}
+
+// Коды ошибок, передаваемые клиенту через redirect_uri (RFC 6749, 4.1.2.1)
+var authorizeErrors = map[uint32]string{
+	errors.InvalidRequest.TypeId: "invalid_request",
+	errors.UnauthorizedClient.TypeId: "unauthorized_client",
+	errors.UnsupportedGrant.TypeId: "unsupported_response_type",
+	errors.InvalidScope.TypeId: "invalid_scope",
+	errors.LoginRequired.TypeId: "login_required",
+}
+
+// Конечные точки OAuth 2.0 для зарегистрированных клиентов
+type OAuth struct {
+	usecase	OAuthUsecase
+
+	// Страница входа, на которую /authorize перенаправляет
+	// пользователя без входа (пустая - ошибка login_required)
+	loginUrl	string
+
+	logger	log.Logger
+}
+
+func NewOAuth(usecase OAuthUsecase, loginUrl string, logger log.Logger) *OAuth {
+	return &OAuth{
+		usecase: usecase,
+		loginUrl: loginUrl,
+		logger: logger,
+	}
+}
+
+func (o *OAuth) Init(router *mux.Router) {
+
+	router.HandleFunc("/introspect", o.Introspect).Methods("POST")
+	router.HandleFunc("/revoke", o.Revoke).Methods("POST")
+	router.HandleFunc("/token", o.Token).Methods("POST")
+	router.HandleFunc("/authorize", o.Authorize).Methods("GET")
+}
+
+// Запрос кода авторизации (RFC 6749, 4.1; RFC 7636)
+func (o *OAuth) Authorize(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	result, err := o.usecase.Authorize(
+		ctx,
+		&dto.AuthorizeRequest{
+			ResponseType: query.Get("response_type"),
+			ClientId: query.Get("client_id"),
+			RedirectUri: query.Get("redirect_uri"),
+			Scope: query.Get("scope"),
+			State: query.Get("state"),
+			CodeChallenge: query.Get("code_challenge"),
+			CodeChallengeMethod: query.Get("code_challenge_method"),
+			Nonce: query.Get("nonce"),
+		},
+		&dto.UserAuthRequest{
+			Headers: r.Header,
+			RemoteAddr: r.RemoteAddr,
+		},
+	)
+
+	if err != nil {
+
+		// Клиент или redirect_uri не прошли проверку:
+		// перенаправлять пользователя нельзя
+		if result == nil {
+			o.error(w, r, err)
+			return
+		}
+
+		// После входа пользователь возвращается к этому же запросу
+		if errutil.TypeIs(err, errors.LoginRequired) && o.loginUrl != "" {
+			redirect(w, r, o.loginUrl, map[string]string{
+				"return_to": r.URL.RequestURI(),
+			})
+			return
+		}
+
+		code, ok := authorizeErrors[errutil.TypeId(err)]
+		if !ok {
+			code = "server_error"
+		}
+
+		logger(r, o.logger, map[string]any{"error": code}).Warn(err)
+
+		redirect(w, r, result.RedirectUri, map[string]string{
+			"error": code,
+			"state": result.State,
+		})
+		return
+	}
+
+	redirect(w, r, result.RedirectUri, map[string]string{
+		"code": result.Code,
+		"state": result.State,
+	})
+}
+
+// Выдача токенов клиенту (RFC 6749). Поддерживаются grant_type
+// client_credentials, authorization_code и token exchange (RFC 8693)
+func (o *OAuth) Token(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		o.tokenError(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+
+	grantType := r.PostFormValue("grant_type")
+	if grantType == "" {
+		o.tokenError(
+			w,
+			http.StatusBadRequest,
+			"invalid_request",
+			"grant_type is required",
+		)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	result, err := o.usecase.Token(ctx, clientCredentials(r), &dto.TokenRequest{
+		GrantType: grantType,
+		Scope: r.PostFormValue("scope"),
+		Code: r.PostFormValue("code"),
+		RedirectUri: r.PostFormValue("redirect_uri"),
+		CodeVerifier: r.PostFormValue("code_verifier"),
+		SubjectToken: r.PostFormValue("subject_token"),
+		SubjectTokenType: r.PostFormValue("subject_token_type"),
+		ActorToken: r.PostFormValue("actor_token"),
+		ActorTokenType: r.PostFormValue("actor_token_type"),
+		Audience: r.PostFormValue("audience"),
+		Meta: &dto.SessionMeta{
+			UserAgent: r.UserAgent(),
+			ClientIp: clientIp(r),
+		},
+	})
+
+	if err != nil {
+
+		if errutil.Has(err, errors.Internal) {
+			logger(r, o.logger, nil).Error(err)
+
+			o.tokenError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+
+		e, ok := tokenErrors[errutil.TypeId(err)]
+		if !ok {
+			e = oauthError{http.StatusInternalServerError, "server_error"}
+		}
+
+		logger(r, o.logger, map[string]any{"code": e.status, "body": e.code}).
+			Warn(err)
+
+		o.tokenError(w, e.status, e.code, err.Error())
+		return
+	}
+
+	Response(w, result)
+}
+
+// Ответ с ошибкой в формате RFC 6749, 5.2
+func (o *OAuth) tokenError(
+	w http.ResponseWriter,
+	status int,
+	code string,
+	description string,
+) {
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="auth-service"`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	body := map[string]string{"error": code}
+
+	if description != "" {
+		body["error_description"] = description
+	}
+
+	json.NewEncoder(w).Encode(body)
+}
+
+// Интроспекция токена (RFC 7662)
+func (o *OAuth) Introspect(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		Error(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	result, err := o.usecase.Introspect(
+		ctx,
+		clientCredentials(r),
+		token,
+		r.PostFormValue("token_type_hint"),
+	)
+
+	if err != nil {
+		o.error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	Response(w, result)
+}
+
+// Отзыв токена (RFC 7009). Для неизвестных и уже недействительных
+// токенов также возвращается 200
+func (o *OAuth) Revoke(w http.ResponseWriter, r *http.Request) {
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		Error(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	err := o.usecase.Revoke(
+		ctx,
+		clientCredentials(r),
+		token,
+		r.PostFormValue("token_type_hint"),
+	)
+
+	if err != nil {
+		o.error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (o *OAuth) error(w http.ResponseWriter, r *http.Request, err error) {
+
+	code, msg := errToHttpResp(err, defErrHttpMapper)
+
+	logger(r, o.logger, map[string]any{"code": code, "body": msg}).
+		Warn(err)
+
+	if code == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="auth-service"`)
+	}
+
+	Error(w, code, msg)
+}
@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"net"
+	"sync"
+	"time"
+	"context"
+	"strings"
+	"testing"
+	"net/url"
+	"net/http"
+	"math/big"
+	"crypto/tls"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/elliptic"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/base64"
+	"net/http/httptest"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+	"github.com/amaretur/auth-service/internal/service"
+	"github.com/amaretur/auth-service/internal/usecase"
+	"github.com/amaretur/auth-service/internal/repository"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Удостоверяющий центр для сертификатов клиентов
+type testCa struct {
+	cert	*x509.Certificate
+	key		*ecdsa.PrivateKey
+}
+
+func newTestCa(t *testing.T) *testCa {
+
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "clients-ca"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCa{cert: cert, key: key}
+}
+
+// Выпускает сертификат клиента с указанными субъектом и DNS именами SAN
+func (ca *testCa) issue(t *testing.T, subject pkix.Name, dnsNames ...string) tls.Certificate {
+
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject: subject,
+		DNSNames: dnsNames,
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// Сервер /token с клиентами, аутентифицирующимися сертификатом mTLS
+func newTlsTokenServer(t *testing.T, ca *testCa) *httptest.Server {
+
+	t.Helper()
+
+	logger := log.NewLogrusLogger()
+
+	key, err := service.LoadKey("", "HS512", "secret", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtService := service.NewJwt(
+		nil, nil, nil, nil, nil, nil, nil,
+		15,
+		60,
+		service.AccessTokenJwt,
+		service.SessionPolicy{},
+		service.ClaimsPolicy{Issuer: "https://auth.example.com"},
+		service.NewKeyRing(key),
+		logger,
+	)
+
+	grants := []string{entity.GrantClientCredentials}
+
+	clients := service.NewClients(
+		repository.NewClientRepositoryMemory([]*entity.Client{
+			{Id: "orders-dn", GrantTypes: grants, TlsSubjectDn: "CN=orders-service,O=Example"},
+			{Id: "orders-san", GrantTypes: grants, TlsSanDns: "orders.internal"},
+			{Id: "billing", GrantTypes: grants, TlsSubjectDn: "CN=billing-service,O=Example"},
+		}),
+		logger,
+	)
+
+	uc := usecase.New(jwtService, clients, nil, nil, nil, nil, nil, false, true, logger)
+
+	h := NewHandler("/api/v1", nil)
+	h.Register(NewOAuth(uc, "", logger), "")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	server := httptest.NewUnstartedServer(h.Router())
+	server.TLS = &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs: pool,
+	}
+	server.StartTLS()
+
+	return server
+}
+
+// HTTP клиент, предъявляющий сертификат (nil - без сертификата)
+func tlsClient(server *httptest.Server, cert *tls.Certificate) *http.Client {
+
+	transport := server.Client().Transport.(*http.Transport).Clone()
+
+	if cert != nil {
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	return &http.Client{Transport: transport}
+}
+
+// Клиент аутентифицируется сертификатом по subject DN или DNS имени SAN
+// (RFC 8705, 2.1), а выданный токен привязывается к сертификату
+// через cnf.x5t#S256 (RFC 8705, 3)
+func TestTlsClientAuth(t *testing.T) {
+
+	ca := newTestCa(t)
+	server := newTlsTokenServer(t, ca)
+	defer server.Close()
+
+	cert := ca.issue(
+		t,
+		pkix.Name{CommonName: "orders-service", Organization: []string{"Example"}},
+		"orders.internal",
+	)
+
+	sum := sha256.Sum256(cert.Certificate[0])
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	foreign := newTestCa(t).issue(
+		t,
+		pkix.Name{CommonName: "orders-service", Organization: []string{"Example"}},
+		"orders.internal",
+	)
+
+	cases := []struct {
+		name		string
+		clientId	string
+		cert		*tls.Certificate
+		wantStatus	int // 0 - TLS соединение не устанавливается
+	}{
+		{"subject dn", "orders-dn", &cert, http.StatusOK},
+		{"san dns", "orders-san", &cert, http.StatusOK},
+		{"another client", "billing", &cert, http.StatusUnauthorized},
+		{"no certificate", "orders-dn", nil, http.StatusUnauthorized},
+		{"untrusted ca", "orders-dn", &foreign, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			form := url.Values{
+				"grant_type": {entity.GrantClientCredentials},
+				"client_id": {c.clientId},
+			}
+
+			resp, err := tlsClient(server, c.cert).Post(
+				server.URL + "/api/v1/token",
+				"application/x-www-form-urlencoded",
+				strings.NewReader(form.Encode()),
+			)
+
+			if c.wantStatus == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("certificate of an untrusted ca accepted")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != c.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, c.wantStatus)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			var tokens dto.TokenResponse
+
+			if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+				t.Fatal(err)
+			}
+
+			claims := &service.AccessClaims{RegisteredClaims: &jwt.RegisteredClaims{}}
+
+			_, _, err = jwt.NewParser().ParseUnverified(tokens.AccessToken, claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if claims.Cnf == nil || claims.Cnf.X5tS256 != thumbprint {
+				t.Fatalf("cnf = %+v, want x5t#S256 %s", claims.Cnf, thumbprint)
+			}
+
+			if claims.ClientId != c.clientId {
+				t.Fatalf("client_id = %q, want %q", claims.ClientId, c.clientId)
+			}
+		})
+	}
+}
+
+type codeRepo struct {
+	mu		sync.Mutex
+	codes	map[string]*entity.AuthorizationCode
+}
+
+func (r *codeRepo) Save(_ context.Context, code *entity.AuthorizationCode) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codes[code.Hash] = code
+
+	return nil
+}
+
+func (r *codeRepo) Consume(
+	_ context.Context,
+	hash string,
+) (*entity.AuthorizationCode, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	code, ok := r.codes[hash]
+	if !ok {
+		return nil, errors.NotFound.New("code not found")
+	}
+
+	delete(r.codes, hash)
+
+	return code, nil
+}
+
+// Заголовок с пользователем принимается только в запросах, соединение
+// которых пришло от доверенного прокси. X-Forwarded-For при этом
+// не учитывается: его может выставить сам клиент
+func TestAuthorizeUserHeaderTrustedProxies(t *testing.T) {
+
+	const (
+		loginUrl	= "https://login.example.com/"
+		callback	= "https://app.example.com/callback"
+		user		= "61f0c404-5cb3-11e7-907b-a6006ad3dba0"
+	)
+
+	logger := log.NewLogrusLogger()
+
+	clients := service.NewClients(
+		repository.NewClientRepositoryMemory([]*entity.Client{
+			{
+				Id: "web-app",
+				GrantTypes: []string{entity.GrantAuthorizationCode},
+				RedirectUris: []string{callback},
+				Public: true,
+			},
+		}),
+		logger,
+	)
+
+	codes := service.NewAuthorizationCodes(
+		&codeRepo{codes: map[string]*entity.AuthorizationCode{}},
+		60,
+		logger,
+	)
+
+	_, trusted, _ := net.ParseCIDR("10.0.0.0/8")
+
+	users := service.NewHeaderAuthenticator(
+		"X-Authenticated-User",
+		[]*net.IPNet{trusted},
+	)
+
+	uc := usecase.New(nil, clients, codes, users, nil, nil, nil, false, false, logger)
+
+	h := NewHandler("/api/v1", []*net.IPNet{trusted})
+	h.Register(NewOAuth(uc, loginUrl, logger), "")
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id": {"web-app"},
+		"redirect_uri": {callback},
+		"state": {"xyz"},
+		"code_challenge": {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {entity.CodeChallengeS256},
+	}
+
+	cases := []struct {
+		name		string
+		remoteAddr	string
+		forwarded	string
+		wantLogin	bool
+	}{
+		{"trusted proxy", "10.0.0.5:41000", "", false},
+		{"trusted proxy, forwarded client", "10.0.0.5:41000", "203.0.113.7", false},
+		{"direct client", "203.0.113.7:52000", "", true},
+		{"direct client, spoofed forwarded", "203.0.113.7:52000", "10.0.0.5", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			r := httptest.NewRequest(
+				http.MethodGet,
+				"/api/v1/authorize?" + query.Encode(),
+				nil,
+			)
+			r.RemoteAddr = c.remoteAddr
+			r.Header.Set("X-Authenticated-User", user)
+
+			if c.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", c.forwarded)
+			}
+
+			w := httptest.NewRecorder()
+			h.Router().ServeHTTP(w, r)
+
+			if w.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+			}
+
+			location, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.wantLogin {
+				if !strings.HasPrefix(location.String(), loginUrl) {
+					t.Fatalf("location = %s, want login page", location)
+				}
+				return
+			}
+
+			if !strings.HasPrefix(location.String(), callback) ||
+				location.Query().Get("code") == "" {
+
+				t.Fatalf("location = %s, want code on %s", location, callback)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/errors"
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+type OidcUsecase interface {
+	OpenIdConfiguration(ctx context.Context) (*dto.OpenIdConfiguration, error)
+	UserInfo(ctx context.Context, access *dto.PresentedToken) (map[string]any, error)
+}
+
+// Конечные точки OpenID Connect: метаданные провайдера и userinfo
+type Oidc struct {
+	usecase	OidcUsecase
+	logger	log.Logger
+}
+
+func NewOidc(usecase OidcUsecase, logger log.Logger) *Oidc {
+	return &Oidc{
+		usecase: usecase,
+		logger: logger,
+	}
+}
+
+func (o *Oidc) Init(router *mux.Router) {
+
+	router.HandleFunc(
+		"/.well-known/openid-configuration",
+		o.Configuration,
+	).Methods("GET")
+
+	router.HandleFunc("/userinfo", o.UserInfo).Methods("GET", "POST")
+}
+
+func (o *Oidc) Configuration(w http.ResponseWriter, r *http.Request) {
+
+	configuration, err := o.usecase.OpenIdConfiguration(r.Context())
+	if err != nil {
+		o.error(w, r, err)
+		return
+	}
+
+	w.Header().Set(
+		"Cache-Control",
+		fmt.Sprintf("public, max-age=%d, must-revalidate", jwksMaxAge),
+	)
+
+	Response(w, configuration)
+}
+
+// Access токен передается в заголовке Authorization,
+// для POST запроса - также в теле формы (RFC 6750, 2.2)
+func (o *Oidc) UserInfo(w http.ResponseWriter, r *http.Request) {
+
+	access, ok := bearerToken(r)
+	if !ok && r.Method == http.MethodPost {
+		access = r.PostFormValue("access_token")
+	}
+
+	if access == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		Error(w, http.StatusUnauthorized, "access token is required")
+		return
+	}
+
+	presented, ok := presentedToken(r, access)
+	if !ok {
+		Error(w, http.StatusBadRequest, "multiple dpop proofs")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	info, err := o.usecase.UserInfo(ctx, presented)
+	if err != nil {
+		o.error(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	Response(w, info)
+}
+
+// Ошибки проверки токена передаются в WWW-Authenticate (RFC 6750, 3)
+func (o *Oidc) error(w http.ResponseWriter, r *http.Request, err error) {
+
+	code, msg := errToHttpResp(err, defErrHttpMapper)
+
+	switch {
+		case errutil.Has(err, errors.InvalidToken):
+			code = http.StatusUnauthorized
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+
+		case errutil.Has(err, errors.InvalidScope):
+			code = http.StatusForbidden
+			w.Header().Set(
+				"WWW-Authenticate",
+				`Bearer error="insufficient_scope", scope="openid"`,
+			)
+	}
+
+	logger(r, o.logger, map[string]any{"code": code, "body": msg}).
+		Warn(err)
+
+	Error(w, code, msg)
+}
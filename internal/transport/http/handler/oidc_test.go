@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"testing"
+	"net/http"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/ecdsa"
+	"encoding/pem"
+	"encoding/json"
+	"crypto/elliptic"
+	"net/http/httptest"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/service"
+	"github.com/amaretur/auth-service/internal/usecase"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+// Метаданные OpenID провайдера. Пустой issuer отключает OpenID Connect
+func discovery(t *testing.T, issuer string, tlsClientAuth bool) *httptest.ResponseRecorder {
+
+	t.Helper()
+
+	logger := log.NewLogrusLogger()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := service.NewKey(
+		jwt.SigningMethodES256,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwtService := service.NewJwt(
+		nil, nil, nil, nil, nil, nil, nil,
+		15,
+		60,
+		service.AccessTokenJwt,
+		service.SessionPolicy{},
+		service.ClaimsPolicy{Issuer: issuer},
+		service.NewKeyRing(key),
+		logger,
+	)
+
+	uc := usecase.New(jwtService, nil, nil, nil, nil, nil, nil, false, tlsClientAuth, logger)
+
+	h := NewHandler("/api/v1", nil)
+	h.Register(NewOidc(uc, logger), "")
+
+	w := httptest.NewRecorder()
+	h.Router().ServeHTTP(
+		w,
+		httptest.NewRequest(http.MethodGet, "/api/v1/.well-known/openid-configuration", nil),
+	)
+
+	return w
+}
+
+// tls_client_auth объявляется, только если сервер проверяет
+// сертификаты клиентов (RFC 8705, 2.1)
+func TestDiscoveryTlsClientAuth(t *testing.T) {
+
+	cases := []struct {
+		name			string
+		tlsClientAuth	bool
+	}{
+		{"without mtls", false},
+		{"with mtls", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			w := discovery(t, "https://auth.example.com", c.tlsClientAuth)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			var configuration dto.OpenIdConfiguration
+
+			if err := json.NewDecoder(w.Body).Decode(&configuration); err != nil {
+				t.Fatal(err)
+			}
+
+			advertised := false
+
+			for _, method := range configuration.TokenEndpointAuthMethodsSupported {
+				if method == "tls_client_auth" {
+					advertised = true
+				}
+			}
+
+			if advertised != c.tlsClientAuth {
+				t.Fatalf(
+					"tls_client_auth advertised = %v, want %v",
+					advertised, c.tlsClientAuth,
+				)
+			}
+
+			if configuration.TlsClientCertificateBoundAccessTokens != c.tlsClientAuth {
+				t.Fatalf(
+					"tls_client_certificate_bound_access_tokens = %v, want %v",
+					configuration.TlsClientCertificateBoundAccessTokens, c.tlsClientAuth,
+				)
+			}
+		})
+	}
+}
+
+// Без issuer метаданные не отдаются: адреса конечных точек
+// строятся от него
+func TestDiscoveryRequiresIssuer(t *testing.T) {
+
+	w := discovery(t, "", false)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"time"
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/amaretur/auth-service/internal/dto"
+
+	"github.com/amaretur/auth-service/pkg/log"
+)
+
+type SessionsUsecase interface {
+	Sessions(ctx context.Context, access *dto.PresentedToken) ([]dto.Session, error)
+
+	RevokeSession(
+		ctx context.Context,
+		access *dto.PresentedToken,
+		sessionId string,
+	) error
+}
+
+// Управление сессиями пользователя. Пользователь определяется
+// по access токену из заголовка Authorization
+type Sessions struct {
+	usecase	SessionsUsecase
+	logger	log.Logger
+}
+
+func NewSessions(usecase SessionsUsecase, logger log.Logger) *Sessions {
+	return &Sessions{
+		usecase: usecase,
+		logger: logger,
+	}
+}
+
+func (s *Sessions) Init(router *mux.Router) {
+
+	router.HandleFunc("", s.List).Methods("GET")
+	router.HandleFunc("/{id}", s.Revoke).Methods("DELETE")
+}
+
+func (s *Sessions) List(w http.ResponseWriter, r *http.Request) {
+
+	access, ok := bearerToken(r)
+	if !ok {
+		Error(w, http.StatusUnauthorized, "access token is required")
+		return
+	}
+
+	presented, ok := presentedToken(r, access)
+	if !ok {
+		Error(w, http.StatusBadRequest, "multiple dpop proofs")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	sessions, err := s.usecase.Sessions(ctx, presented)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	Response(w, sessions)
+}
+
+func (s *Sessions) Revoke(w http.ResponseWriter, r *http.Request) {
+
+	access, ok := bearerToken(r)
+	if !ok {
+		Error(w, http.StatusUnauthorized, "access token is required")
+		return
+	}
+
+	presented, ok := presentedToken(r, access)
+	if !ok {
+		Error(w, http.StatusBadRequest, "multiple dpop proofs")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5 * time.Second)
+	defer cancel()
+
+	err := s.usecase.RevokeSession(ctx, presented, mux.Vars(r)["id"])
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Sessions) error(w http.ResponseWriter, r *http.Request, err error) {
+
+	code, msg := errToHttpResp(err, defErrHttpMapper)
+
+	logger(r, s.logger, map[string]any{"code": code, "body": msg}).
+		Warn(err)
+
+	Error(w, code, msg)
+}
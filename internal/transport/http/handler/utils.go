@@ -1,17 +1,34 @@
 package handler
 
 import (
+	"strings"
+	"net/url"
 	"net/http"
+	"crypto/sha256"
+	"encoding/base64"
 
+	"github.com/amaretur/auth-service/internal/dto"
 	"github.com/amaretur/auth-service/internal/errors"
 	errutil "github.com/amaretur/auth-service/pkg/errors"
 
 	"github.com/amaretur/auth-service/pkg/reqid"
 	"github.com/amaretur/auth-service/pkg/log"
+	"github.com/amaretur/auth-service/pkg/clientip"
 )
 
 var defErrHttpMapper = map[uint32]int{
 	errors.InvalidToken.TypeId: http.StatusForbidden,
+	errors.Unauthorized.TypeId: http.StatusUnauthorized,
+	errors.NotFound.TypeId: http.StatusNotFound,
+	errors.SessionLimit.TypeId: http.StatusConflict,
+	errors.SessionExpired.TypeId: http.StatusUnauthorized,
+	errors.InvalidScope.TypeId: http.StatusBadRequest,
+	errors.UnauthorizedClient.TypeId: http.StatusForbidden,
+	errors.UnsupportedGrant.TypeId: http.StatusBadRequest,
+	errors.InvalidRequest.TypeId: http.StatusBadRequest,
+	errors.InvalidGrant.TypeId: http.StatusBadRequest,
+	errors.LoginRequired.TypeId: http.StatusUnauthorized,
+	errors.InvalidDPoPProof.TypeId: http.StatusBadRequest,
 }
 
 func errToHttpResp(err error, mapper map[uint32]int) (int, string) {
@@ -45,3 +62,141 @@ func logger(
 		"response": responseData,
 	})
 }
+
+// Извлекает учетные данные клиента из заголовка Authorization (Basic)
+// или из параметров формы client_id и client_secret (RFC 6749, 2.3.1).
+// При mTLS к ним добавляется сертификат клиента (RFC 8705)
+func clientCredentials(r *http.Request) *dto.ClientCredentials {
+
+	if id, secret, ok := r.BasicAuth(); ok {
+
+		// Идентификатор и секрет кодируются как application/x-www-form-urlencoded
+		if decoded, err := url.QueryUnescape(id); err == nil {
+			id = decoded
+		}
+
+		if decoded, err := url.QueryUnescape(secret); err == nil {
+			secret = decoded
+		}
+
+		return &dto.ClientCredentials{
+			Id: id,
+			Secret: secret,
+			Certificate: clientCertificate(r),
+		}
+	}
+
+	return &dto.ClientCredentials{
+		Id: r.PostFormValue("client_id"),
+		Secret: r.PostFormValue("client_secret"),
+		Certificate: clientCertificate(r),
+	}
+}
+
+// Сертификат клиента, проверенный TLS сервером по CA из конфигурации.
+// Без mTLS соединения возвращает nil
+func clientCertificate(r *http.Request) *dto.ClientCertificate {
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	sum := sha256.Sum256(cert.Raw)
+
+	return &dto.ClientCertificate{
+		SubjectDn: cert.Subject.String(),
+		DnsNames: cert.DNSNames,
+		Thumbprint: base64.RawURLEncoding.EncodeToString(sum[:]),
+	}
+}
+
+// IP адрес клиента (справочно, для списка сессий), определенный
+// middleware.ClientIp с учетом доверенных прокси
+func clientIp(r *http.Request) string {
+	return clientip.FromContext(r.Context())
+}
+
+// DPoP доказательство из заголовка DPoP (RFC 9449, 4.1). Возвращает nil
+// без заголовка и false, если заголовков несколько. Передается только
+// путь запроса: схема и хост заголовкам запроса не доверяются
+func dpopProof(r *http.Request) (*dto.DPoPProof, bool) {
+
+	values := r.Header.Values("DPoP")
+
+	if len(values) > 1 {
+		return nil, false
+	}
+
+	if len(values) == 0 {
+		return nil, true
+	}
+
+	return &dto.DPoPProof{
+		Proof: values[0],
+		Method: r.Method,
+		Path: r.URL.Path,
+	}, true
+}
+
+// Access токен вместе с DPoP доказательством и сертификатом mTLS,
+// которыми клиент подтверждает владение ключом привязанного токена.
+// Возвращает false, если заголовков DPoP несколько
+func presentedToken(r *http.Request, access string) (*dto.PresentedToken, bool) {
+
+	proof, ok := dpopProof(r)
+	if !ok {
+		return nil, false
+	}
+
+	if proof != nil {
+		proof.AccessToken = access
+	}
+
+	return &dto.PresentedToken{
+		Token: access,
+		Proof: proof,
+		Certificate: clientCertificate(r),
+	}, true
+}
+
+// Извлекает токен из заголовка Authorization: Bearer <token>
+// или DPoP <token> для привязанных к ключу токенов (RFC 9449, 7.1)
+func bearerToken(r *http.Request) (string, bool) {
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || token == "" ||
+		!(strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, "DPoP")) {
+		return "", false
+	}
+
+	return token, true
+}
+
+// Перенаправляет на адрес, добавляя к нему параметры запроса
+// (пустые значения не добавляются)
+func redirect(
+	w http.ResponseWriter,
+	r *http.Request,
+	target string,
+	params map[string]string,
+) {
+
+	u, err := url.Parse(target)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, "invalid redirect uri")
+		return
+	}
+
+	query := u.Query()
+
+	for name, value := range params {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
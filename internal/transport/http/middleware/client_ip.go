@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net"
+	"fmt"
+	"strings"
+	"net/http"
+
+	"github.com/amaretur/auth-service/pkg/clientip"
+)
+
+// Разбирает список доверенных прокси: IP адреса или подсети в нотации CIDR
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+
+	networks := make([]*net.IPNet, 0, len(proxies))
+
+	for _, proxy := range proxies {
+
+		if !strings.Contains(proxy, "/") {
+
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+
+			networks = append(networks, &net.IPNet{
+				IP: ip,
+				Mask: net.CIDRMask(bits, bits),
+			})
+
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// Определяет IP адрес клиента. X-Forwarded-For учитывается только
+// в запросах от доверенных прокси: адреса в заголовке просматриваются
+// справа налево, и клиентом считается первый недоверенный адрес.
+// Без доверенных прокси используется адрес соединения
+func ClientIp(trusted []*net.IPNet) func(http.Handler) http.Handler {
+
+	isTrusted := func(ip string) bool {
+		return clientip.IsTrusted(ip, trusted)
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+
+			if isTrusted(ip) {
+
+				forwarded := strings.Split(
+					strings.Join(r.Header.Values("X-Forwarded-For"), ","),
+					",",
+				)
+
+				for i := len(forwarded) - 1; i >= 0; i-- {
+
+					hop := strings.TrimSpace(forwarded[i])
+					if hop == "" {
+						continue
+					}
+
+					ip = hop
+
+					if !isTrusted(hop) {
+						break
+					}
+				}
+			}
+
+			ctx := clientip.ToContext(r.Context(), ip)
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/amaretur/auth-service/pkg/clientip"
+)
+
+func TestClientIp(t *testing.T) {
+
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name		string
+		remote		string
+		forwarded	string
+		want		string
+	}{
+		{"direct", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"untrusted peer", "203.0.113.5:4000", "198.51.100.7", "203.0.113.5"},
+		{"trusted proxy", "10.1.2.3:4000", "198.51.100.7", "198.51.100.7"},
+		{"proxy chain", "10.1.2.3:4000", "6.6.6.6, 198.51.100.7, 192.168.1.1", "198.51.100.7"},
+		{"only proxies", "10.1.2.3:4000", "10.0.0.1", "10.0.0.1"},
+		{"no header", "10.1.2.3:4000", "", "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var got string
+
+			h := ClientIp(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientip.FromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Fatalf("ip = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatal("invalid proxy accepted")
+	}
+}
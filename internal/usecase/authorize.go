@@ -0,0 +1,193 @@
+package usecase
+
+import (
+	"time"
+	"context"
+
+	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
+
+	errutil "github.com/amaretur/auth-service/pkg/errors"
+)
+
+// Выдает код авторизации (RFC 6749, 4.1.1). Пока клиент и redirect_uri
+// не проверены, результат равен nil и ошибка возвращается пользователю.
+// После проверки ошибка передается клиенту через redirect_uri
+func (u *Usecase) Authorize(
+	ctx context.Context,
+	request *dto.AuthorizeRequest,
+	user *dto.UserAuthRequest,
+) (*dto.AuthorizeResult, error) {
+
+	client, err := u.clients.Get(ctx, request.ClientId)
+	if err != nil {
+
+		if errutil.Has(err, errors.NotFound) {
+			return nil, errors.InvalidRequest.New("unknown client")
+		}
+
+		return nil, err
+	}
+
+	redirectUri, err := resolveRedirectUri(client, request.RedirectUri)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dto.AuthorizeResult{
+		RedirectUri: redirectUri,
+		State: request.State,
+	}
+
+	if request.ResponseType != "code" {
+		return result, errors.UnsupportedGrant.New(
+			"unsupported response type: " + request.ResponseType,
+		)
+	}
+
+	if !client.AllowsGrant(entity.GrantAuthorizationCode) {
+		return result, errors.UnauthorizedClient.New(
+			"grant type not allowed: " + entity.GrantAuthorizationCode,
+		)
+	}
+
+	// PKCE обязателен для всех клиентов
+	if request.CodeChallenge == "" ||
+		request.CodeChallengeMethod != entity.CodeChallengeS256 {
+
+		return result, errors.InvalidRequest.New(
+			"code_challenge with S256 method is required",
+		)
+	}
+
+	uuid, err := u.users.Authenticate(ctx, user)
+	if err != nil {
+		return result, err
+	}
+
+	result.Code, err = u.codes.Issue(ctx, &entity.AuthorizationCode{
+		ClientId: client.Id,
+		RedirectUri: redirectUri,
+		RedirectUriExplicit: request.RedirectUri != "",
+		Uuid: uuid,
+		Scope: request.Scope,
+		CodeChallenge: request.CodeChallenge,
+		Nonce: request.Nonce,
+		AuthTime: time.Now(),
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Обменивает код авторизации на пару токенов (RFC 6749, 4.1.3)
+func (u *Usecase) exchangeCode(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+	request *dto.TokenRequest,
+) (*dto.TokenResponse, error) {
+
+	if request.Code == "" || request.CodeVerifier == "" {
+		return nil, errors.InvalidRequest.New("code and code_verifier are required")
+	}
+
+	var (
+		client	*entity.Client
+		err		error
+	)
+
+	// Публичный клиент предъявляет только client_id,
+	// его подлинность подтверждает PKCE
+	if credentials.Secret == "" && credentials.Certificate == nil {
+		client, err = u.clients.AuthenticatePublic(ctx, credentials.Id)
+	} else {
+		client, err = u.authenticate(ctx, credentials)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(entity.GrantAuthorizationCode) {
+		return nil, errors.UnauthorizedClient.New(
+			"grant type not allowed: " + entity.GrantAuthorizationCode,
+		)
+	}
+
+	// redirect_uri сверяется с указанным при авторизации
+	code, err := u.codes.Redeem(
+		ctx,
+		request.Code,
+		client.Id,
+		request.RedirectUri,
+		request.CodeVerifier,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cnf, err := u.confirmation(ctx, credentials, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := u.jwt.CreateTokens(
+		ctx,
+		code.Uuid,
+		request.Meta,
+		code.Scope,
+		client,
+		cnf,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// ID токен выдается, только если запрошена область openid
+	idToken, err := u.jwt.IdToken(
+		ctx,
+		client,
+		code.Uuid,
+		code.Nonce,
+		code.AuthTime,
+		tokens,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.TokenResponse{
+		AccessToken: tokens.Access,
+		TokenType: "Bearer",
+		ExpiresIn: tokens.ExpiresIn,
+		RefreshToken: tokens.Refresh,
+		Scope: tokens.Scope,
+		IdToken: idToken,
+	}, nil
+}
+
+// Проверяет redirect_uri по реестру клиентов. Если у клиента
+// зарегистрирован единственный адрес, redirect_uri можно не указывать
+func resolveRedirectUri(
+	client *entity.Client,
+	redirectUri string,
+) (string, error) {
+
+	if redirectUri == "" {
+
+		if len(client.RedirectUris) == 1 {
+			return client.RedirectUris[0], nil
+		}
+
+		return "", errors.InvalidRequest.New("redirect_uri is required")
+	}
+
+	if !client.AllowsRedirectUri(redirectUri) {
+		return "", errors.InvalidRequest.New("redirect_uri is not registered")
+	}
+
+	return redirectUri, nil
+}
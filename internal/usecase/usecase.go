@@ -1,43 +1,486 @@
 package usecase
 
 import (
+	"time"
 	"context"
 
 	"github.com/amaretur/auth-service/internal/dto"
+	"github.com/amaretur/auth-service/internal/entity"
+	"github.com/amaretur/auth-service/internal/errors"
 
 	"github.com/amaretur/auth-service/pkg/log"
 )
 
 type JwtService interface {
-	CreateTokens(ctx context.Context, uuid string) (*dto.Tokens, error)
-	RefreshTokens(ctx context.Context, tokens *dto.Tokens) (*dto.Tokens, error)
+	CreateTokens(
+		ctx context.Context,
+		uuid string,
+		meta *dto.SessionMeta,
+		scope string,
+		client *entity.Client,
+		cnf *dto.Confirmation,
+	) (*dto.Tokens, error)
+
+	RefreshTokens(
+		ctx context.Context,
+		tokens *dto.Tokens,
+		client *entity.Client,
+		cnf *dto.Confirmation,
+	) (*dto.Tokens, error)
+
+	RevokeTokens(ctx context.Context, tokens *dto.Tokens) error
+	RevokeAllTokens(ctx context.Context, tokens *dto.Tokens) error
+	Jwks(ctx context.Context) *dto.Jwks
+
+	Introspect(
+		ctx context.Context,
+		token string,
+		hint string,
+	) (*dto.Introspection, error)
+
+	Revoke(
+		ctx context.Context,
+		client *entity.Client,
+		token string,
+		hint string,
+	) error
+
+	ClientCredentialsToken(
+		ctx context.Context,
+		client *entity.Client,
+		scope string,
+		cnf *dto.Confirmation,
+	) (*dto.TokenResponse, error)
+
+	Sessions(
+		ctx context.Context,
+		access string,
+		presented *dto.Confirmation,
+	) ([]dto.Session, error)
+
+	RevokeSession(
+		ctx context.Context,
+		access string,
+		presented *dto.Confirmation,
+		sessionId string,
+	) error
+
+	IdToken(
+		ctx context.Context,
+		client *entity.Client,
+		uuid string,
+		nonce string,
+		authTime time.Time,
+		tokens *dto.Tokens,
+	) (string, error)
+
+	OpenIdConfiguration(ctx context.Context) (*dto.OpenIdConfiguration, error)
+}
+
+type ClientService interface {
+	Authenticate(
+		ctx context.Context,
+		id string,
+		secret string,
+	) (*entity.Client, error)
+
+	AuthenticateCertificate(
+		ctx context.Context,
+		id string,
+		cert *dto.ClientCertificate,
+	) (*entity.Client, error)
+
+	AuthenticatePublic(ctx context.Context, id string) (*entity.Client, error)
+	Get(ctx context.Context, id string) (*entity.Client, error)
+}
+
+type AuthorizationCodeService interface {
+	Issue(ctx context.Context, code *entity.AuthorizationCode) (string, error)
+
+	Redeem(
+		ctx context.Context,
+		code string,
+		clientId string,
+		redirectUri string,
+		codeVerifier string,
+	) (*entity.AuthorizationCode, error)
+}
+
+// Обмен токенов (RFC 8693)
+type TokenExchangeService interface {
+	Exchange(
+		ctx context.Context,
+		client *entity.Client,
+		request *dto.TokenRequest,
+		cnf *dto.Confirmation,
+	) (*dto.TokenResponse, error)
+}
+
+// Проверка DPoP доказательств (RFC 9449): возвращает отпечаток ключа
+type DPoPService interface {
+	Verify(ctx context.Context, proof *dto.DPoPProof) (string, error)
+}
+
+// Сведения о пользователе для /userinfo (OpenID Connect)
+type UserInfoService interface {
+	UserInfo(
+		ctx context.Context,
+		access string,
+		presented *dto.Confirmation,
+	) (map[string]any, error)
+}
+
+// Определяет пользователя, выполнившего вход, для выдачи кода авторизации
+type UserAuthenticator interface {
+	Authenticate(
+		ctx context.Context,
+		request *dto.UserAuthRequest,
+	) (string, error)
 }
 
 type Usecase struct {
 	jwt JwtService
+	clients ClientService
+	codes AuthorizationCodeService
+	users UserAuthenticator
+	userInfo UserInfoService
+	exchange TokenExchangeService
+	dpop DPoPService
+
+	// Вход и обновление токенов только для зарегистрированных клиентов
+	requireClient bool
+
+	// Сервер проверяет сертификаты клиентов (mTLS)
+	tlsClientAuth bool
 
 	logger log.Logger
 }
 
-func New(jwt JwtService, logger log.Logger) *Usecase {
+func New(
+	jwt JwtService,
+	clients ClientService,
+	codes AuthorizationCodeService,
+	users UserAuthenticator,
+	userInfo UserInfoService,
+	exchange TokenExchangeService,
+	dpop DPoPService,
+	requireClient bool,
+	tlsClientAuth bool,
+	logger log.Logger,
+) *Usecase {
 	return &Usecase{
 		jwt: jwt,
+		clients: clients,
+		codes: codes,
+		users: users,
+		userInfo: userInfo,
+		exchange: exchange,
+		dpop: dpop,
+		requireClient: requireClient,
+		tlsClientAuth: tlsClientAuth,
 		logger: logger,
 	}
 }
 
 func (u *Usecase) SignIn(
 	ctx context.Context,
+	credentials *dto.ClientCredentials,
 	uuid string,
+	meta *dto.SessionMeta,
+	scope string,
+	proof *dto.DPoPProof,
 ) (*dto.Tokens, error) {
 
-	return u.jwt.CreateTokens(ctx, uuid)
+	client, err := u.client(ctx, credentials, entity.GrantSignIn)
+	if err != nil {
+		return nil, err
+	}
+
+	cnf, err := u.confirmation(ctx, credentials, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.jwt.CreateTokens(ctx, uuid, meta, scope, client, cnf)
 }
 
 func (u *Usecase) Refresh(
 	ctx context.Context,
+	credentials *dto.ClientCredentials,
 	tokens *dto.Tokens,
+	proof *dto.DPoPProof,
 ) (*dto.Tokens, error) {
 
-	return u.jwt.RefreshTokens(ctx, tokens)
+	client, err := u.client(ctx, credentials, entity.GrantRefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	cnf, err := u.confirmation(ctx, credentials, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.jwt.RefreshTokens(ctx, tokens, client, cnf)
+}
+
+// Ключ и сертификат, к которым привязываются токены: отпечаток ключа
+// из DPoP доказательства и сертификата mTLS. Без них возвращает nil
+func (u *Usecase) confirmation(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+	proof *dto.DPoPProof,
+) (*dto.Confirmation, error) {
+
+	cnf := &dto.Confirmation{}
+
+	if proof != nil {
+
+		jkt, err := u.dpop.Verify(ctx, proof)
+		if err != nil {
+			return nil, err
+		}
+
+		cnf.Jkt = jkt
+	}
+
+	if credentials != nil && credentials.Certificate != nil {
+		cnf.X5tS256 = credentials.Certificate.Thumbprint
+	}
+
+	if cnf.Jkt == "" && cnf.X5tS256 == "" {
+		return nil, nil
+	}
+
+	return cnf, nil
+}
+
+// Ключи, владение которыми клиент подтвердил вместе с access токеном:
+// DPoP доказательство для этого токена и сертификат mTLS
+func (u *Usecase) presentedKeys(
+	ctx context.Context,
+	access *dto.PresentedToken,
+) (*dto.Confirmation, error) {
+
+	credentials := &dto.ClientCredentials{Certificate: access.Certificate}
+
+	return u.confirmation(ctx, credentials, access.Proof)
+}
+
+func (u *Usecase) Logout(
+	ctx context.Context,
+	tokens *dto.Tokens,
+) error {
+
+	return u.jwt.RevokeTokens(ctx, tokens)
+}
+
+func (u *Usecase) LogoutAll(
+	ctx context.Context,
+	tokens *dto.Tokens,
+) error {
+
+	return u.jwt.RevokeAllTokens(ctx, tokens)
+}
+
+func (u *Usecase) Sessions(
+	ctx context.Context,
+	access *dto.PresentedToken,
+) ([]dto.Session, error) {
+
+	presented, err := u.presentedKeys(ctx, access)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.jwt.Sessions(ctx, access.Token, presented)
+}
+
+func (u *Usecase) RevokeSession(
+	ctx context.Context,
+	access *dto.PresentedToken,
+	sessionId string,
+) error {
+
+	presented, err := u.presentedKeys(ctx, access)
+	if err != nil {
+		return err
+	}
+
+	return u.jwt.RevokeSession(ctx, access.Token, presented, sessionId)
+}
+
+func (u *Usecase) Jwks(ctx context.Context) *dto.Jwks {
+	return u.jwt.Jwks(ctx)
+}
+
+func (u *Usecase) OpenIdConfiguration(
+	ctx context.Context,
+) (*dto.OpenIdConfiguration, error) {
+
+	configuration, err := u.jwt.OpenIdConfiguration(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Аутентификация сертификатом доступна, только если сервер
+	// запрашивает его у клиента (RFC 8705, 2.1 и 3.3)
+	if u.tlsClientAuth {
+		configuration.TokenEndpointAuthMethodsSupported = append(
+			configuration.TokenEndpointAuthMethodsSupported,
+			"tls_client_auth",
+		)
+		configuration.TlsClientCertificateBoundAccessTokens = true
+	}
+
+	return configuration, nil
+}
+
+func (u *Usecase) UserInfo(
+	ctx context.Context,
+	access *dto.PresentedToken,
+) (map[string]any, error) {
+
+	presented, err := u.presentedKeys(ctx, access)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.userInfo.UserInfo(ctx, access.Token, presented)
+}
+
+// Интроспекция токена по запросу зарегистрированного клиента
+func (u *Usecase) Introspect(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+	token string,
+	hint string,
+) (*dto.Introspection, error) {
+
+	_, err := u.authenticate(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.jwt.Introspect(ctx, token, hint)
+}
+
+// Отзыв токена по запросу зарегистрированного клиента
+func (u *Usecase) Revoke(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+	token string,
+	hint string,
+) error {
+
+	client, err := u.authenticate(ctx, credentials)
+	if err != nil {
+		return err
+	}
+
+	return u.jwt.Revoke(ctx, client, token, hint)
+}
+
+// Выдает токены по запросу клиента к конечной точке /token (RFC 6749)
+func (u *Usecase) Token(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+	request *dto.TokenRequest,
+) (*dto.TokenResponse, error) {
+
+	switch request.GrantType {
+		case entity.GrantClientCredentials:
+			client, err := u.authorizeClient(ctx, credentials, request.GrantType)
+			if err != nil {
+				return nil, err
+			}
+
+			cnf, err := u.confirmation(ctx, credentials, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			return u.jwt.ClientCredentialsToken(ctx, client, request.Scope, cnf)
+
+		case entity.GrantAuthorizationCode:
+			return u.exchangeCode(ctx, credentials, request)
+
+		case entity.GrantTokenExchange:
+			client, err := u.authorizeClient(ctx, credentials, request.GrantType)
+			if err != nil {
+				return nil, err
+			}
+
+			cnf, err := u.confirmation(ctx, credentials, nil)
+			if err != nil {
+				return nil, err
+			}
+
+			return u.exchange.Exchange(ctx, client, request, cnf)
+
+		default:
+			return nil, errors.UnsupportedGrant.New(
+				"unsupported grant type: " + request.GrantType,
+			)
+	}
+}
+
+// Аутентифицирует клиента и проверяет, что ему разрешен способ получения
+// токенов. Без учетных данных возвращает nil, если клиент не обязателен
+func (u *Usecase) client(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+	grant string,
+) (*entity.Client, error) {
+
+	if credentials == nil || credentials.Id == "" {
+
+		if u.requireClient {
+			return nil, errors.Unauthorized.New("client authentication required")
+		}
+
+		return nil, nil
+	}
+
+	return u.authorizeClient(ctx, credentials, grant)
+}
+
+// Аутентифицирует клиента и проверяет, что ему разрешен
+// способ получения токенов
+func (u *Usecase) authorizeClient(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+	grant string,
+) (*entity.Client, error) {
+
+	client, err := u.authenticate(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.AllowsGrant(grant) {
+		return nil, errors.UnauthorizedClient.New(
+			"grant type not allowed: " + grant,
+		)
+	}
+
+	return client, nil
+}
+
+// Аутентифицирует клиента по секрету или, если секрет не передан,
+// по сертификату mTLS (RFC 8705)
+func (u *Usecase) authenticate(
+	ctx context.Context,
+	credentials *dto.ClientCredentials,
+) (*entity.Client, error) {
+
+	if credentials.Secret == "" && credentials.Certificate != nil {
+		return u.clients.AuthenticateCertificate(
+			ctx,
+			credentials.Id,
+			credentials.Certificate,
+		)
+	}
+
+	return u.clients.Authenticate(ctx, credentials.Id, credentials.Secret)
 }
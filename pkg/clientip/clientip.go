@@ -0,0 +1,38 @@
+package clientip
+
+import (
+	"net"
+	"context"
+)
+
+type key struct{}
+
+func ToContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, key{}, ip)
+}
+
+func FromContext(ctx context.Context) string {
+
+	if ip, ok := ctx.Value(key{}).(string); ok {
+		return ip
+	}
+
+	return ""
+}
+
+// Проверяет, входит ли адрес в одну из доверенных подсетей
+func IsTrusted(ip string, trusted []*net.IPNet) bool {
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}